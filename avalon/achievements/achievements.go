@@ -0,0 +1,389 @@
+package achievements
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/delay"
+	"appengine/taskqueue"
+	"avalon/api"
+	"avalon/data"
+	"avalon/data/cards"
+	"avalon/db"
+	"avalon/stats"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"os"
+	"time"
+)
+
+func init() {
+	http.Handle("/player/stats", web.AjaxHandler(ReqPlayerStats))
+}
+
+// An EventCount matches when at least Min of a game's missions (or
+// votes) pass all of the filters that are set, from the point of view
+// of the seat being checked
+type EventCount struct {
+	// The seat was on the team
+	OnTeam *bool `json:"on_team"`
+	// The seat was the leader
+	Leader *bool `json:"leader"`
+	// Missions only: whether the mission succeeded
+	Succeeded *bool `json:"succeeded"`
+	// Missions only: at least this many fails
+	MinFails int `json:"min_fails"`
+	// Votes only: whether the team was approved
+	Approved *bool `json:"approved"`
+	// Votes only: "approve" or "reject", how the seat voted
+	Vote string `json:"vote"`
+	Min int `json:"min"`
+}
+
+// An AchievementDefinition is loaded from the achievement definitions
+// file. Every condition which is set must hold for the seat.
+type AchievementDefinition struct {
+	Id string `json:"id"`
+	Name string `json:"name"`
+	Description string `json:"description"`
+
+	// The label of the card the seat held
+	Role string `json:"role"`
+	// "good" or "evil"
+	Team string `json:"team"`
+	Won *bool `json:"won"`
+	// How the game ended - see stats.GameEnding
+	Ending string `json:"ending"`
+	// The seat was the assassin (see data.Game.FindAssassin)
+	Assassin *bool `json:"assassin"`
+	// The assassin took a shot and missed
+	AssassinMissed *bool `json:"assassin_missed"`
+	MaxGoodScore *int `json:"max_good_score"`
+	MaxEvilScore *int `json:"max_evil_score"`
+
+	Missions *EventCount `json:"missions"`
+	Votes *EventCount `json:"votes"`
+}
+
+var definitions []AchievementDefinition
+
+func AddAchievementDefinition(def AchievementDefinition) error {
+	if def.Id == "" {
+		return errors.New("Achievement definition has no id")
+	}
+	for _, other := range definitions {
+		if other.Id == def.Id {
+			return errors.New("Achievement " + def.Id + " is defined twice")
+		}
+	}
+	if def.Role != "" {
+		if _, ok := cards.CardFactory[def.Role]; !ok {
+			return errors.New("Achievement " + def.Id + " has invalid role " + def.Role)
+		}
+	}
+	if def.Team != "" && def.Team != "good" && def.Team != "evil" {
+		return errors.New("Achievement " + def.Id + " has invalid team " + def.Team)
+	}
+	definitions = append(definitions, def)
+	return nil
+}
+
+// This reads a JSON list of AchievementDefinitions and registers each
+// of them. The cards must be loaded first.
+func LoadAchievementDefinitions(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var defs []AchievementDefinition
+	err = json.NewDecoder(f).Decode(&defs)
+	if err != nil {
+		return err
+	}
+
+	for _, def := range defs {
+		err = AddAchievementDefinition(def)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetAchievementDefinitions() []AchievementDefinition {
+	return definitions
+}
+
+// GameEvents is everything achievements are checked against
+type GameEvents struct {
+	Game data.Game
+	Votes []data.VoteResult
+	Missions []data.MissionResult
+}
+
+func onTeam(players []int, seat int) bool {
+	for _, pos := range players {
+		if pos == seat {
+			return true
+		}
+	}
+	return false
+}
+
+func boolMatches(want *bool, have bool) bool {
+	return want == nil || *want == have
+}
+
+func (count EventCount) matchesMission(result data.MissionResult, seat int) bool {
+	return boolMatches(count.OnTeam, onTeam(result.Players, seat)) &&
+		boolMatches(count.Leader, result.Leader == seat) &&
+		boolMatches(count.Succeeded, result.Fails <= result.FailsAllowed) &&
+		result.Fails >= count.MinFails
+}
+
+func (count EventCount) matchesVote(result data.VoteResult, seat int) bool {
+	approves := 0
+	for _, vote := range result.Votes {
+		if vote {
+			approves++
+		}
+	}
+	vote := "reject"
+	if seat < len(result.Votes) && result.Votes[seat] {
+		vote = "approve"
+	}
+	return boolMatches(count.OnTeam, onTeam(result.Players, seat)) &&
+		boolMatches(count.Leader, result.Leader == seat) &&
+		boolMatches(count.Approved, approves > len(result.Votes) - approves) &&
+		(count.Vote == "" || count.Vote == vote)
+}
+
+// This returns whether the seat has earned the achievement in this game
+func (def AchievementDefinition) Earned(events GameEvents, seat int) bool {
+	game := events.Game
+	card := game.Cards[game.Roles[seat]]
+
+	if def.Role != "" && card.Label() != def.Role {
+		return false
+	}
+	if def.Team != "" && (def.Team == "evil") != card.AllocatedAsSpy() {
+		return false
+	}
+	if !boolMatches(def.Won, card.HasWon(game)) {
+		return false
+	}
+	if def.Ending != "" && def.Ending != stats.GameEnding(game) {
+		return false
+	}
+	if !boolMatches(def.Assassin, game.FindAssassin() == seat) {
+		return false
+	}
+	missed := game.State.AssassinTarget != -1 && cards.GoodHasWon(game)
+	if !boolMatches(def.AssassinMissed, missed) {
+		return false
+	}
+	if def.MaxGoodScore != nil && game.State.GoodScore > *def.MaxGoodScore {
+		return false
+	}
+	if def.MaxEvilScore != nil && game.State.EvilScore > *def.MaxEvilScore {
+		return false
+	}
+
+	if def.Missions != nil {
+		n := 0
+		for _, result := range events.Missions {
+			if def.Missions.matchesMission(result, seat) {
+				n++
+			}
+		}
+		if n < def.Missions.Min {
+			return false
+		}
+	}
+
+	if def.Votes != nil {
+		n := 0
+		for _, result := range events.Votes {
+			if def.Votes.matchesVote(result, seat) {
+				n++
+			}
+		}
+		if n < def.Votes.Min {
+			return false
+		}
+	}
+
+	return true
+}
+
+func loadGameEvents(c appengine.Context, game data.Game) (GameEvents, error) {
+	events := GameEvents{Game: game, Missions: []data.MissionResult{}}
+
+	votes, err := db.GetVoteResults(c, game)
+	if err != nil {
+		return events, err
+	}
+	events.Votes = votes
+
+	results, err := db.GetMissionResults(c, game)
+	if err != nil {
+		return events, err
+	}
+	for _, result := range results {
+		if result != nil {
+			events.Missions = append(events.Missions, *result)
+		}
+	}
+
+	return events, nil
+}
+
+func award(c appengine.Context, userid string, id string, game data.Game) error {
+	return datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		pachievement, err := db.GetAchievement(tc, userid, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		achievement := data.Achievement{UserID: userid, Id: id, FirstGame: game.Id, FirstTime: now}
+		if pachievement != nil {
+			achievement = *pachievement
+			if achievement.LastGame == game.Id {
+				// Already awarded for this game
+				return nil
+			}
+		}
+		achievement.Count++
+		achievement.LastGame = game.Id
+		achievement.LastTime = now
+
+		return db.StoreAchievement(tc, achievement)
+	}, nil)
+}
+
+var recordGameLater = delay.Func("achievements.RecordGame", record_game)
+
+// This awards achievements for a finished game. It reads the game's
+// results, so it runs from a task after the transaction which ended the
+// game has committed; running it twice for a game does no harm.
+func record_game(c appengine.Context, roomid string, gameid string) error {
+	game, err := db.RetrieveGame(c, roomid, gameid)
+	if err != nil {
+		return err
+	}
+	if game == nil {
+		c.Errorf("No game %s in %s to award achievements for", gameid, roomid)
+		return nil
+	}
+	err = db.EnsureGameState(c, game, true)
+	if err != nil {
+		return err
+	}
+	if !game.State.GameOver {
+		c.Errorf("Game %s in %s isn't over, so not awarding achievements", gameid, roomid)
+		return nil
+	}
+
+	events, err := loadGameEvents(c, *game)
+	if err != nil {
+		return err
+	}
+
+	isAI := map[int]bool{}
+	for _, seat := range game.AIs {
+		isAI[seat] = true
+	}
+
+	for seat, userid := range game.UserIDs {
+		if isAI[seat] || userid == "" || seat >= len(game.Roles) {
+			continue
+		}
+		for _, def := range definitions {
+			if !def.Earned(events, seat) {
+				continue
+			}
+			err := award(c, userid, def.Id, *game)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// This is called in the transaction that ends a game. It adds a task
+// to award the game's achievements, which only runs if the transaction
+// commits; the task retries until it succeeds.
+func RecordGame(c appengine.Context, game data.Game) error {
+	if !game.State.GameOver {
+		return errors.New("Cannot award achievements for a game which is not over")
+	}
+
+	task, err := recordGameLater.Task(game.Room, game.Id)
+	if err != nil {
+		return err
+	}
+	_, err = taskqueue.Add(c, task, "")
+	return err
+}
+
+type AchievementInfo struct {
+	Id string `json:"id"`
+	Name string `json:"name"`
+	Description string `json:"description"`
+	// This is nil if the player hasn't earned it
+	Earned *data.Achievement `json:"earned"`
+}
+
+type PlayerStatsResponse struct {
+	Guest bool `json:"guest"`
+	Ratings []data.Rating `json:"ratings"`
+	Achievements []AchievementInfo `json:"achievements"`
+}
+
+// This returns the session user's ratings along with every
+// achievement, earned or not
+func ReqPlayerStats(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	userID, ok := session.Values["userID"].(string)
+	if !ok || 0 == len(userID) {
+		m := "Not authenticated via oauth"
+		return &web.AppError{web.Coded(api.ErrNotAuthenticated), m, 401}
+	}
+
+	ratings, err := db.GetPlayerRatings(c, userID)
+	if err != nil {
+		return &web.AppError{err, "Error retrieving ratings", 500}
+	}
+
+	earned, err := db.GetAchievements(c, userID)
+	if err != nil {
+		return &web.AppError{err, "Error retrieving achievements", 500}
+	}
+	byId := map[string]*data.Achievement{}
+	for i := range earned {
+		byId[earned[i].Id] = &earned[i]
+	}
+
+	response := PlayerStatsResponse{
+		Guest: data.IsGuest(userID),
+		Ratings: ratings,
+		Achievements: make([]AchievementInfo, len(definitions)),
+	}
+	for i, def := range definitions {
+		response.Achievements[i] = AchievementInfo{def.Id, def.Name, def.Description, byId[def.Id]}
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err = json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
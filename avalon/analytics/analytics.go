@@ -0,0 +1,338 @@
+package analytics
+
+import (
+	"appengine"
+	"avalon/data"
+	"avalon/data/cards"
+	"avalon/db"
+	"avalon/web"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	http.Handle("/admin/analytics", web.AppHandler(ReqAnalytics))
+}
+
+// Games are read in pages, so that each request finishes well inside
+// the request deadline. The cursor for the next page is sent in the
+// X-Next-Cursor header, which is empty after the last page.
+const defaultPageSize = 100
+
+// A row is written as a JSON object or a CSV line. Missions and
+// proposals are 1-based, as in the ajax API; seats are 0-based.
+type column struct {
+	Name string
+	Value interface{}
+}
+
+type row []column
+
+type rowWriter interface {
+	Write(r row) error
+	Flush() error
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (w jsonlWriter) Write(r row) error {
+	values := map[string]interface{}{}
+	for _, col := range r {
+		values[col.Name] = col.Value
+	}
+	return w.enc.Encode(values)
+}
+
+func (w jsonlWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+	header bool
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case []int:
+		s := make([]string, len(v))
+		for i, n := range v {
+			s[i] = strconv.Itoa(n)
+		}
+		return strings.Join(s, ";")
+	case []string:
+		return strings.Join(v, ";")
+	case []bool:
+		s := make([]string, len(v))
+		for i, b := range v {
+			s[i] = strconv.FormatBool(b)
+		}
+		return strings.Join(s, ";")
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+func (w *csvWriter) Write(r row) error {
+	if !w.header {
+		names := make([]string, len(r))
+		for i, col := range r {
+			names[i] = col.Name
+		}
+		err := w.w.Write(names)
+		if err != nil {
+			return err
+		}
+		w.header = true
+	}
+
+	values := make([]string, len(r))
+	for i, col := range r {
+		values[i] = csvValue(col.Value)
+	}
+	return w.w.Write(values)
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func roleLabels(game data.Game, seats []int) []string {
+	labels := make([]string, len(seats))
+	for i, seat := range seats {
+		labels[i] = game.Cards[game.Roles[seat]].Label()
+	}
+	return labels
+}
+
+func teams(game data.Game, seats []int) []string {
+	teams := make([]string, len(seats))
+	for i, seat := range seats {
+		teams[i] = "good"
+		if game.Cards[game.Roles[seat]].AllocatedAsSpy() {
+			teams[i] = "evil"
+		}
+	}
+	return teams
+}
+
+// Guests are counted apart from players with accounts
+func guestSeats(game data.Game) []int {
+	seats := []int{}
+	for seat, userid := range game.UserIDs {
+		if data.IsGuest(userid) {
+			seats = append(seats, seat)
+		}
+	}
+	return seats
+}
+
+func allSeats(game data.Game) []int {
+	seats := make([]int, len(game.Roles))
+	for i := range seats {
+		seats[i] = i
+	}
+	return seats
+}
+
+func gameRows(c appengine.Context, game data.Game) ([]row, error) {
+	winner := "evil"
+	if cards.GoodHasWon(game) {
+		winner = "good"
+	}
+	return []row{{
+		{"game", game.Id},
+		{"room", game.Room},
+		{"start_time", game.StartTime},
+		{"players", len(game.Roles)},
+		{"roles", roleLabels(game, allSeats(game))},
+		{"teams", teams(game, allSeats(game))},
+		{"ais", game.AIs},
+		{"guests", guestSeats(game)},
+		{"good_score", game.State.GoodScore},
+		{"evil_score", game.State.EvilScore},
+		{"votes", game.State.ThisVote},
+		{"assassin", game.FindAssassin()},
+		{"assassin_target", game.State.AssassinTarget},
+		{"winner", winner},
+	}}, nil
+}
+
+func voteRows(c appengine.Context, game data.Game) ([]row, error) {
+	results, err := db.GetVoteResults(c, game)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []row{}
+	for _, result := range results {
+		approves := 0
+		for _, vote := range result.Votes {
+			if vote {
+				approves++
+			}
+		}
+		rows = append(rows, row{
+			{"game", game.Id},
+			{"vote", result.Index + 1},
+			{"mission", result.Mission + 1},
+			{"proposal", result.Proposal + 1},
+			{"leader", result.Leader},
+			{"leader_role", game.Cards[game.Roles[result.Leader]].Label()},
+			{"team", result.Players},
+			{"team_roles", roleLabels(game, result.Players)},
+			{"team_evil", countEvil(game, result.Players)},
+			{"votes", result.Votes},
+			{"voter_roles", roleLabels(game, allSeats(game))},
+			{"approves", approves},
+			{"approved", approves > len(result.Votes) - approves},
+		})
+	}
+	return rows, nil
+}
+
+func countEvil(game data.Game, seats []int) int {
+	evil := 0
+	for _, team := range teams(game, seats) {
+		if team == "evil" {
+			evil++
+		}
+	}
+	return evil
+}
+
+func missionRows(c appengine.Context, game data.Game) ([]row, error) {
+	results, err := db.GetMissionResults(c, game)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []row{}
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		rows = append(rows, row{
+			{"game", game.Id},
+			{"mission", result.Mission + 1},
+			{"proposal", result.Proposal + 1},
+			{"leader", result.Leader},
+			{"leader_role", game.Cards[game.Roles[result.Leader]].Label()},
+			{"team", result.Players},
+			{"team_roles", roleLabels(game, result.Players)},
+			{"team_evil", countEvil(game, result.Players)},
+			{"fails", result.Fails},
+			{"fails_allowed", result.FailsAllowed},
+			{"succeeded", result.Fails <= result.FailsAllowed},
+		})
+	}
+	return rows, nil
+}
+
+var tables = map[string]func(appengine.Context, data.Game) ([]row, error){
+	"games": gameRows,
+	"votes": voteRows,
+	"missions": missionRows,
+}
+
+// This writes one page of finished games, as format ("jsonl" or
+// "csv") rows from table ("games", "votes" or "missions"), starting
+// at cursor
+func ReqAnalytics(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	table := r.FormValue("table")
+	if table == "" {
+		table = "games"
+	}
+	makeRows, ok := tables[table]
+	if !ok {
+		m := "Invalid table " + table
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	var out rowWriter
+	switch format {
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		out = jsonlWriter{json.NewEncoder(w)}
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		out = &csvWriter{w: csv.NewWriter(w)}
+	default:
+		m := "Invalid format " + format
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	limit := defaultPageSize
+	if r.FormValue("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(r.FormValue("limit"))
+		if err != nil || limit <= 0 {
+			m := "Invalid limit"
+			return &web.AppError{errors.New(m), m, 400}
+		}
+	}
+
+	games, cursor, err := db.GamesFrom(c, r.FormValue("cursor"), limit)
+	if err != nil {
+		return &web.AppError{err, "Error listing games", 500}
+	}
+	if len(games) < limit {
+		cursor = ""
+	}
+
+	// The whole page is read before anything is written, so that if a
+	// game can't be read the request fails, and the client can retry
+	// from the same cursor, rather than getting a page with rows missing
+	rows := []row{}
+	for _, game := range games {
+		err := db.EnsureGameState(c, &game, false)
+		if err != nil {
+			return &web.AppError{err, "Error retrieving game state for " + game.Id, 500}
+		}
+		if !game.State.GameOver {
+			continue
+		}
+
+		gamerows, err := makeRows(c, game)
+		if err != nil {
+			return &web.AppError{err, "Error retrieving " + table + " for " + game.Id, 500}
+		}
+		rows = append(rows, gamerows...)
+	}
+
+	w.Header().Set("X-Next-Cursor", cursor)
+	for _, row := range rows {
+		err = out.Write(row)
+		if err != nil {
+			return writeError(c, err)
+		}
+	}
+
+	err = out.Flush()
+	if err != nil {
+		return writeError(c, err)
+	}
+	return nil
+}
+
+// An error writing the response can't be sent to the client, since
+// part of the response has already gone
+func writeError(c appengine.Context, err error) *web.AppError {
+	c.Errorf("Error writing analytics: %s", err)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Package api describes version 1 of the public API, served under
+// /api/v1: the request and response types, and the endpoints which
+// use them. The OpenAPI document at /api/v1/openapi.json is generated
+// from what is here.
+//
+// v1 covers everything a client needs to play: starting a session,
+// logging in, getting into a room and its games, choosing the cards,
+// playing the games, and going on to rematches and series.
+//
+// Within v1 the API only ever grows. Endpoints, fields and enum values
+// may be added, so clients must ignore fields they don't know, but
+// nothing is removed, renamed or changes meaning. Anything which would
+// break a client goes into a v2 alongside v1 instead.
+//
+// Throughout v1, mission, proposal and vote numbers count from 1, and
+// seats count from 0 as indexes into GameState.Players.
+//
+// This package only depends on the standard library, so that clients
+// can use it.
+package api
+
+const (
+	Version = "1.0.0"
+	Prefix = "/api/v1"
+)
+
+// These are the values of GameState.Phase
+const (
+	PhasePicking = "picking"
+	PhaseVoting = "voting"
+	PhaseMission = "mission"
+	PhaseAssassination = "assassination"
+	PhaseGameOver = "game_over"
+)
+
+// Every endpoint is a POST of JSON, which answers with JSON. Failures
+// answer with an Error and an HTTP status other than 200.
+type Endpoint struct {
+	Path string
+	Summary string
+	// These are the zero values of the types sent and returned; a nil
+	// Request means the body is ignored
+	Request interface{}
+	Response interface{}
+	// Public endpoints need no session or CSRF token
+	Public bool
+}
+
+var Endpoints = []Endpoint{
+	{"/session", "Start a session, and get its CSRF token", nil, Session{}, true},
+	{"/auth/token", "Log in with an account", LogInRequest{}, Empty{}, false},
+	{"/auth/guest", "Log in as the guest in the guest cookie, or a new guest", GuestRequest{}, Guest{}, false},
+	{"/room/create", "Make a room, with you as its host", CreateRoomRequest{}, Room{}, false},
+	{"/room/join", "Join a room's lobby, or change your name in it", JoinRoomRequest{}, Room{}, false},
+	{"/room/lobby", "Get your room's lobby and settings", nil, Room{}, false},
+	{"/room/ready", "Say whether you are ready to start", ReadyRequest{}, Room{}, false},
+	{"/room/settings", "Change the settings, as the host; everybody has to be ready again", RoomSettings{}, Room{}, false},
+	{"/room/leave", "Leave your room", nil, Empty{}, false},
+	{"/room/start", "Start a game once everybody is ready, as the host", nil, GameState{}, false},
+	{"/game/join", "Join the current game in your room", nil, GameState{}, false},
+	{"/game/state", "Get the state of your game", nil, GameState{}, false},
+	{"/game/reveal", "Get what you know about the other players", nil, Reveals{}, false},
+	{"/game/propose", "Propose a team, as the leader", ProposeRequest{}, GameState{}, false},
+	{"/game/vote", "Vote on the current proposal; votes can't be changed", VoteRequest{}, GameState{}, false},
+	{"/game/mission", "Act on a mission you are on", MissionRequest{}, GameState{}, false},
+	{"/game/assassin", "Choose who to assassinate, as the assassin", AssassinRequest{}, GameState{}, false},
+	{"/game/decide", "Make a decision your card has asked for", DecideRequest{}, GameState{}, false},
+	{"/game/poke", "Finish a vote or mission which has all its moves in", nil, GameState{}, false},
+	{"/game/rematch", "Answer a rematch of your finished game, or see how it is going", RematchRequest{}, Rematch{}, false},
+	{"/game/setup", "Get the missions for a number of players, and the cards to choose from", SetupRequest{}, GameSetup{}, false},
+	{"/game/checkcards", "Check a set of cards for a game", CheckCardsRequest{}, CardCheck{}, false},
+	{"/game/knowledge", "Find out who sees whom with a set of cards", KnowledgeRequest{}, Knowledge{}, false},
+	{"/series/start", "Start a series in your room, outside a lobby, and join its first game", SeriesStartRequest{}, GameState{}, false},
+	{"/series/next", "Start or join the next game of your room's series", nil, GameState{}, false},
+	{"/series/summary", "Get the standings in your room's series", nil, SeriesSummary{}, false},
+}
@@ -0,0 +1,61 @@
+package api
+
+// Error codes are stable names for what went wrong, for clients and
+// bots to check instead of the message. The first group are for errors
+// with no more specific code; see StatusCodes.
+const (
+	ErrBadRequest = "bad_request"
+	ErrForbidden = "forbidden"
+	ErrNotFound = "not_found"
+	ErrMethodNotAllowed = "method_not_allowed"
+	ErrConflict = "conflict"
+	ErrInternal = "internal_error"
+
+	ErrInvalidJSON = "invalid_json"
+	ErrInvalidCSRFToken = "invalid_csrf_token"
+	ErrOriginNotAllowed = "origin_not_allowed"
+	ErrNotAuthenticated = "not_authenticated"
+	ErrBadCredentials = "bad_credentials"
+
+	ErrNotInGame = "not_in_game"
+	ErrGameOver = "game_over"
+	ErrGameInProgress = "game_in_progress"
+	// It is somebody else's move, or the player has no part in it
+	ErrNotYourTurn = "not_your_turn"
+	// The move is for a proposal or mission which has been and gone;
+	// the details have the current mission and proposal
+	ErrStaleProposal = "stale_proposal"
+	// The game isn't at a point where the move makes sense
+	ErrWrongPhase = "wrong_phase"
+	ErrAlreadyActed = "already_acted"
+	// The move itself is not allowed, such as a bad team
+	ErrInvalidMove = "invalid_move"
+
+	ErrNotInRoom = "not_in_room"
+	ErrNotHost = "not_host"
+	ErrNotReady = "not_ready"
+	ErrRoomFull = "room_full"
+)
+
+// These are the codes of errors with no more specific code
+var StatusCodes = map[int]string{
+	400: ErrBadRequest,
+	401: ErrNotAuthenticated,
+	403: ErrForbidden,
+	404: ErrNotFound,
+	405: ErrMethodNotAllowed,
+	409: ErrConflict,
+	500: ErrInternal,
+}
+
+type Error struct {
+	Code string `json:"code" doc:"A stable name for what went wrong, such as not_your_turn or stale_proposal"`
+	Message string `json:"message" doc:"A description of the error for people"`
+	Status int `json:"status" doc:"The HTTP status"`
+	Details interface{} `json:"details,omitempty" doc:"More about the error, depending on the code: stale_proposal has a StaleProposal"`
+}
+
+type StaleProposal struct {
+	Mission int `json:"mission" doc:"The current mission"`
+	Proposal int `json:"proposal" doc:"The current proposal"`
+}
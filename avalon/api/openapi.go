@@ -0,0 +1,201 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// This is the subset of an OpenAPI 3 schema object that the API's
+// types need
+type Schema struct {
+	Ref string `json:"$ref,omitempty"`
+	Type string `json:"type,omitempty"`
+	Format string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	Enum []string `json:"enum,omitempty"`
+	Items *Schema `json:"items,omitempty"`
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required []string `json:"required,omitempty"`
+}
+
+type schemas map[string]*Schema
+
+// This returns the schema for a type, adding any structs it uses to
+// the named schemas
+func (named schemas) schema(t reflect.Type) *Schema {
+	if t == reflect.TypeOf(time.Time{}) {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return named.schema(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Name() != "" {
+			break
+		}
+		return &Schema{Type: "array", Items: named.schema(t.Elem())}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			panic("No schema for type " + t.String())
+		}
+		return &Schema{Type: "object", AdditionalProperties: named.schema(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+	default:
+		panic("No schema for type " + t.String())
+	}
+
+	ref := &Schema{Ref: "#/components/schemas/" + t.Name()}
+	if _, ok := named[t.Name()]; ok {
+		return ref
+	}
+
+	// Add it before filling it in, in case it refers to itself
+	schema := &Schema{}
+	named[t.Name()] = schema
+	if t.Kind() == reflect.Slice {
+		schema.Type = "array"
+		schema.Items = named.schema(t.Elem())
+		return ref
+	}
+
+	schema.Type = "object"
+	schema.Properties = map[string]*Schema{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+
+		property := named.schema(field.Type)
+		// Siblings of a $ref are ignored, so only inline schemas get
+		// descriptions
+		if doc := field.Tag.Get("doc"); doc != "" && property.Ref == "" {
+			property.Description = doc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property.Enum = strings.Split(enum, ",")
+		}
+		schema.Properties[tag[0]] = property
+
+		if len(tag) < 2 || tag[1] != "omitempty" {
+			schema.Required = append(schema.Required, tag[0])
+		}
+	}
+
+	return ref
+}
+
+const description = `Everything is a POST of JSON to a path under
+/api/v1. Start with /session, then log in with /auth/token or
+/auth/guest, get into a room with /room/create or /room/join, and join
+its game with /game/join. /game/setup, /game/checkcards and
+/game/knowledge help with choosing the cards, and a finished game goes
+on with /game/rematch, or with /series/next in a series.
+Requests are authenticated by the session cookie, and everything after
+/session must send the session's CSRF token in an x-csrf-token header.
+
+Within v1 the API only grows: endpoints, fields and enum values may be
+added, so ignore what you don't know, but nothing is removed, renamed
+or changes meaning. Mission, proposal and vote numbers count from 1;
+seats count from 0.`
+
+func json_content(schema *Schema) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// This turns a path like /game/state into gameState
+func operation_id(path string) string {
+	id := ""
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if id == "" {
+			id = part
+		} else {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return id
+}
+
+// This returns the OpenAPI document for the API, with server as the
+// base URL of the site
+func OpenAPI(server string) map[string]interface{} {
+	named := schemas{}
+	errorResponse := map[string]interface{}{
+		"description": "The request failed",
+		"content": json_content(named.schema(reflect.TypeOf(Error{}))),
+	}
+	// StaleProposal is only ever in an Error's details
+	named.schema(reflect.TypeOf(StaleProposal{}))
+
+	paths := map[string]interface{}{}
+	for _, endpoint := range Endpoints {
+		operation := map[string]interface{}{
+			"operationId": operation_id(endpoint.Path),
+			"summary": endpoint.Summary,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "OK",
+					"content": json_content(named.schema(reflect.TypeOf(endpoint.Response))),
+				},
+				"default": errorResponse,
+			},
+		}
+		if endpoint.Public {
+			operation["security"] = []interface{}{}
+		}
+		if endpoint.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": json_content(named.schema(reflect.TypeOf(endpoint.Request))),
+			}
+		}
+		paths[Prefix + endpoint.Path] = map[string]interface{}{"post": operation}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title": "Avalon",
+			"version": Version,
+			"description": description,
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": server},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": named,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{
+					"type": "apiKey",
+					"in": "cookie",
+					"name": "sessionName",
+				},
+				"csrf": map[string]interface{}{
+					"type": "apiKey",
+					"in": "header",
+					"name": "x-csrf-token",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"session": []string{}, "csrf": []string{}},
+		},
+	}
+}
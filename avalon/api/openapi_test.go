@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Every type in Endpoints must have a schema, or OpenAPI panics when
+// /api/v1/openapi.json is first asked for
+func TestOpenAPI(t *testing.T) {
+	doc := OpenAPI("https://example.com")
+	_, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal("Error encoding the document: ", err)
+	}
+
+	paths := doc["paths"].(map[string]interface{})
+	if len(paths) != len(Endpoints) {
+		t.Errorf("%d paths for %d endpoints", len(paths), len(Endpoints))
+	}
+
+	ids := map[string]string{}
+	for _, endpoint := range Endpoints {
+		if _, ok := paths[Prefix + endpoint.Path]; !ok {
+			t.Errorf("No path for %s", endpoint.Path)
+		}
+		id := operation_id(endpoint.Path)
+		if other, ok := ids[id]; ok {
+			t.Errorf("%s and %s have the same operation id %s", other, endpoint.Path, id)
+		}
+		ids[id] = endpoint.Path
+	}
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"appengine"
+	"avalon/api"
+	"avalon/auth"
+	"avalon/web"
+	"encoding/json"
+	"github.com/gorilla/sessions"
+	"net/http"
+)
+
+func ReqLogIn(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.LogInRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	aerr := auth.LogIn(w, r, c, session, auth.AuthData{
+		Provider: request.Provider,
+		Token: request.Token,
+		Username: request.Username,
+		Password: request.Password,
+	})
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_json(w, &api.Empty{})
+}
+
+func ReqGuest(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.GuestRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	guest, aerr := auth.LogInAsGuest(w, r, c, session, auth.GuestData{Name: request.Name})
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_json(w, &api.Guest{Name: guest.Name})
+}
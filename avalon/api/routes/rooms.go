@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"appengine"
+	"avalon/api"
+	"avalon/data"
+	"avalon/gameplay/start"
+	"avalon/rooms"
+	"avalon/web"
+	"encoding/json"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+)
+
+func write_room(w http.ResponseWriter, r *http.Request, c appengine.Context, room data.Room) *web.AppError {
+	response, aerr := rooms.MakeRoomResponse(r, c, room)
+	if aerr != nil {
+		return aerr
+	}
+
+	players := make([]api.LobbyPlayer, len(room.Names))
+	for i, name := range room.Names {
+		players[i] = api.LobbyPlayer{Name: name, Ready: room.Ready[i], Host: room.UserIDs[i] == room.Owner}
+	}
+
+	return write_json(w, &api.Room{
+		Code: room.Code,
+		Link: response.Link,
+		Players: players,
+		Settings: api.RoomSettings{
+			Cards: room.Cards,
+			AIs: room.AIs,
+			Series: room.Series,
+			BestOf: room.BestOf,
+			FixedSeating: room.FixedSeating,
+			RotateRoles: room.RotateRoles,
+		},
+		AllReady: response.AllReady,
+		InGame: response.InGame,
+	})
+}
+
+func ReqRoomCreate(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.CreateRoomRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	proom, aerr := rooms.CreateRoom(w, r, c, session, rooms.RoomCreateData{Name: request.Name})
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_room(w, r, c, *proom)
+}
+
+func ReqRoomJoin(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.JoinRoomRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	proom, aerr := rooms.JoinRoom(w, r, c, session, rooms.RoomJoinData{Code: request.Code, Name: request.Name})
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_room(w, r, c, *proom)
+}
+
+func ReqRoomLobby(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	proom, _, aerr := rooms.GetLobby(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_room(w, r, c, *proom)
+}
+
+func ReqRoomReady(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.ReadyRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	proom, aerr := rooms.SetReady(c, session, rooms.RoomReadyData{Ready: request.Ready})
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_room(w, r, c, *proom)
+}
+
+func ReqRoomSettings(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.RoomSettings
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	proom, aerr := rooms.ChangeSettings(c, session, rooms.RoomSettingsData{
+		Cards: request.Cards,
+		AIs: request.AIs,
+		Series: request.Series,
+		BestOf: request.BestOf,
+		FixedSeating: request.FixedSeating,
+		RotateRoles: request.RotateRoles,
+	})
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_room(w, r, c, *proom)
+}
+
+func ReqRoomLeave(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	aerr := rooms.LeaveRoom(w, r, c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_json(w, &api.Empty{})
+}
+
+func ReqRoomStart(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	pgame, mypos, aerr := start.StartRoomGame(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	err := session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+
+	return write_state(w, c, *pgame, mypos)
+}
@@ -0,0 +1,320 @@
+package routes
+
+import (
+	"appengine"
+	"avalon/api"
+	"avalon/data"
+	"avalon/gameplay"
+	"avalon/gameplay/start"
+	"avalon/gameplay/state"
+	"avalon/gameplay/view"
+	"avalon/web"
+	"encoding/json"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Every endpoint in api.Endpoints is served by the handler here for its
+// path, so that the two can't drift apart
+var handlers = map[string]http.Handler{
+	"/session": web.AppHandler(ReqSession),
+	"/auth/token": web.AjaxHandler(ReqLogIn),
+	"/auth/guest": web.AjaxHandler(ReqGuest),
+	"/room/create": web.AjaxHandler(ReqRoomCreate),
+	"/room/join": web.AjaxHandler(ReqRoomJoin),
+	"/room/lobby": web.AjaxHandler(ReqRoomLobby),
+	"/room/ready": web.AjaxHandler(ReqRoomReady),
+	"/room/settings": web.AjaxHandler(ReqRoomSettings),
+	"/room/leave": web.AjaxHandler(ReqRoomLeave),
+	"/room/start": web.AjaxHandler(ReqRoomStart),
+	"/game/join": web.AjaxHandler(ReqJoin),
+	"/game/state": web.GameHandler(ReqState),
+	"/game/reveal": web.GameHandler(ReqReveal),
+	"/game/propose": web.GameHandler(ReqPropose),
+	"/game/vote": web.GameHandler(ReqVote),
+	"/game/mission": web.GameHandler(ReqMission),
+	"/game/assassin": web.GameHandler(ReqAssassin),
+	"/game/decide": web.GameHandler(ReqDecide),
+	"/game/poke": web.GameHandler(ReqPoke),
+	"/game/rematch": web.GameHandler(ReqRematch),
+	"/game/setup": web.AjaxHandler(ReqSetup),
+	"/game/checkcards": web.AjaxHandler(ReqCheckCards),
+	"/game/knowledge": web.AjaxHandler(ReqKnowledge),
+	"/series/start": web.AjaxHandler(ReqSeriesStart),
+	"/series/next": web.AjaxHandler(ReqSeriesNext),
+	"/series/summary": web.AjaxHandler(ReqSeriesSummary),
+}
+
+func init() {
+	http.Handle(api.Prefix + "/openapi.json", web.AppHandler(ReqOpenAPI))
+
+	for _, endpoint := range api.Endpoints {
+		handler, ok := handlers[endpoint.Path]
+		if !ok {
+			panic("No handler for " + endpoint.Path)
+		}
+		http.Handle(api.Prefix + endpoint.Path, handler)
+	}
+	if len(handlers) != len(api.Endpoints) {
+		panic("Handlers for endpoints which aren't in api.Endpoints")
+	}
+}
+
+func ReqOpenAPI(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	server := web.Config.ServerPath
+	if appengine.IsDevAppServer() {
+		server = web.Config.DevServerPath
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	err := json.NewEncoder(w).Encode(api.OpenAPI(strings.TrimSuffix(server, "/")))
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
+
+// This is the same as loading app.js, for clients which aren't a
+// browser: it gives the session a CSRF token, keeping any it has
+func ReqSession(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	if !web.CheckOrigin(w, r) {
+		m := "Origin not allowed"
+		return &web.AppError{web.Coded(api.ErrOriginNotAllowed), m, 403}
+	}
+
+	token, ok := session.Values["state"].(string)
+	if !ok {
+		token = data.RandomString(64)
+		session.Values["state"] = token
+		err := session.Save(r, w)
+		if err != nil {
+			log.Println("error saving session:", err)
+		}
+	}
+
+	return write_json(w, &api.Session{CSRFToken: token})
+}
+
+func make_setup(setup data.GameSetup) api.Setup {
+	missions := make([]api.MissionSetup, len(setup.Missions))
+	for i, mission := range setup.Missions {
+		missions[i] = api.MissionSetup{Size: mission.Size, FailsAllowed: mission.FailsAllowed}
+	}
+	return api.Setup{Missions: missions, Cards: setup.Cards, Spies: setup.Spies}
+}
+
+// This turns the /game/state payload, which has a different type in
+// each phase, into an api.GameState
+func make_state(general view.GameStateGeneral, mypos int) api.GameState {
+	results := []api.MissionResult{}
+	for _, result := range general.Results {
+		if result == nil {
+			continue
+		}
+		results = append(results, api.MissionResult{
+			Mission: result.Mission + 1,
+			Proposal: result.Proposal + 1,
+			Leader: result.Leader,
+			Players: result.Players,
+			Fails: result.Fails,
+			FailsAllowed: result.FailsAllowed,
+		})
+	}
+
+	votes := make([]api.VoteResult, len(general.Votes))
+	for i, vote := range general.Votes {
+		votes[i] = api.VoteResult{
+			Vote: vote.Index + 1,
+			Mission: vote.Mission + 1,
+			Proposal: vote.Proposal + 1,
+			Leader: vote.Leader,
+			Players: vote.Players,
+			Votes: vote.Votes,
+		}
+	}
+
+	decisions := make([]api.Decision, len(general.Decisions))
+	for i, decision := range general.Decisions {
+		decisions[i] = api.Decision{Id: decision.Id, Kind: decision.Kind, Label: decision.Label, Players: decision.Players}
+	}
+
+	return api.GameState{
+		Game: general.Id,
+		Seat: mypos,
+		Players: general.Players,
+		Setup: make_setup(general.Setup),
+		Leader: general.Leader,
+		// These are already 1-based
+		Mission: general.ThisMission,
+		Proposal: general.ThisProposal,
+		Results: results,
+		Votes: votes,
+		Decisions: decisions,
+	}
+}
+
+func LoadState(c appengine.Context, game data.Game, mypos int) (api.GameState, *web.AppError) {
+	pstate, aerr := state.LoadGameState(c, game, mypos)
+	if aerr != nil {
+		return api.GameState{}, aerr
+	}
+
+	var gamestate api.GameState
+	switch s := pstate.(type) {
+	case view.GameStatePicking:
+		gamestate = make_state(s.General, mypos)
+		gamestate.Phase = api.PhasePicking
+		gamestate.Picking = &api.PickingState{Size: s.MissionSize, FailsAllowed: s.MissionFailsAllowed}
+	case view.GameStateVoting:
+		gamestate = make_state(s.General, mypos)
+		gamestate.Phase = api.PhaseVoting
+		gamestate.Voting = &api.VotingState{Players: s.MissionPlayers, Voted: s.VotedPlayers}
+	case view.GameStateMission:
+		actions := []string{}
+		for action, allowed := range s.AllowActions {
+			if allowed {
+				actions = append(actions, action)
+			}
+		}
+		sort.Strings(actions)
+
+		gamestate = make_state(s.General, mypos)
+		gamestate.Phase = api.PhaseMission
+		gamestate.MissionState = &api.MissionState{Players: s.MissionPlayers, Acted: s.ActedPlayers, Actions: actions}
+	case view.GameStateAssassination:
+		gamestate = make_state(s.General, mypos)
+		gamestate.Phase = api.PhaseAssassination
+		gamestate.Assassination = &api.AssassinationState{Assassin: s.Assassin, Cards: s.Cards}
+	case view.GameStateOver:
+		gamestate = make_state(s.General, mypos)
+		gamestate.Phase = api.PhaseGameOver
+		gamestate.GameOver = &api.GameOverState{
+			Winner: s.Winner,
+			Won: s.Won,
+			Result: s.Result,
+			AssassinTarget: s.AssassinTarget,
+			Cards: s.Cards,
+			Rematch: s.Rematch,
+		}
+	default:
+		panic("Unknown game state type")
+	}
+
+	return gamestate, nil
+}
+
+func write_json(w http.ResponseWriter, response interface{}) *web.AppError {
+	w.Header().Set("Content-type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+	return nil
+}
+
+func write_state(w http.ResponseWriter, c appengine.Context, game data.Game, mypos int) *web.AppError {
+	gamestate, aerr := LoadState(c, game, mypos)
+	if aerr != nil {
+		return aerr
+	}
+	return write_json(w, &gamestate)
+}
+
+// This decodes the request body, and runs the command made from it
+func run_move(w http.ResponseWriter, r *http.Request, c appengine.Context, game data.Game, mypos int, request interface{}, command func() gameplay.Command) *web.AppError {
+	if request != nil {
+		err := json.NewDecoder(r.Body).Decode(request)
+		if err != nil {
+			return web.JSONError(err)
+		}
+	}
+
+	aerr := gameplay.RunCommand(c, &game, mypos, command())
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_state(w, c, game, mypos)
+}
+
+func ReqJoin(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	aerr := start.ValidateGameJoin(session)
+	if aerr != nil {
+		return aerr
+	}
+
+	pgame, mypos, aerr := start.DoGameStartOrJoin(c, session, nil)
+	if aerr != nil {
+		return aerr
+	}
+
+	err := session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+
+	return write_state(w, c, *pgame, mypos)
+}
+
+func ReqState(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	return write_state(w, c, game, mypos)
+}
+
+func ReqReveal(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	reveals, aerr := start.LoadGameReveal(c, game, mypos)
+	if aerr != nil {
+		return aerr
+	}
+
+	response := make(api.Reveals, len(reveals))
+	for i, reveal := range reveals {
+		response[i] = api.Reveal{Players: reveal.Players, Label: reveal.Label}
+	}
+	return write_json(w, response)
+}
+
+func ReqPropose(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	var request api.ProposeRequest
+	return run_move(w, r, c, game, mypos, &request, func() gameplay.Command {
+		return &gameplay.ProposeData{Mission: request.Mission - 1, Proposal: request.Proposal - 1, Players: request.Players}
+	})
+}
+
+func ReqVote(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	var request api.VoteRequest
+	return run_move(w, r, c, game, mypos, &request, func() gameplay.Command {
+		return &gameplay.VoteData{Mission: request.Mission - 1, Proposal: request.Proposal - 1, Vote: request.Vote}
+	})
+}
+
+func ReqMission(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	var request api.MissionRequest
+	return run_move(w, r, c, game, mypos, &request, func() gameplay.Command {
+		return &gameplay.ActionData{Mission: request.Mission - 1, Proposal: request.Proposal - 1, Action: request.Action}
+	})
+}
+
+func ReqAssassin(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	var request api.AssassinRequest
+	return run_move(w, r, c, game, mypos, &request, func() gameplay.Command {
+		return &gameplay.AssassinData{Target: request.Target}
+	})
+}
+
+func ReqDecide(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	var request api.DecideRequest
+	return run_move(w, r, c, game, mypos, &request, func() gameplay.Command {
+		return &gameplay.DecideData{Decision: request.Decision, Choice: request.Choice}
+	})
+}
+
+func ReqPoke(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	return run_move(w, r, c, game, mypos, nil, func() gameplay.Command {
+		return &gameplay.PokeData{}
+	})
+}
@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"appengine"
+	"avalon/api"
+	"avalon/data"
+	"avalon/data/cards"
+	"avalon/gameplay/start"
+	"avalon/web"
+	"encoding/json"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+)
+
+func ReqRematch(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	var request api.RematchRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	response, aerr := start.AnswerRematch(w, r, c, session, game, mypos, start.RematchData{Accept: request.Accept})
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_json(w, &api.Rematch{
+		Responses: response.Responses,
+		Deadline: response.Deadline,
+		Cancelled: response.Cancelled,
+		Started: response.Started,
+		Joined: response.Joined,
+	})
+}
+
+func make_card_info(info cards.CardInfo) api.CardInfo {
+	return api.CardInfo{
+		Label: info.Label,
+		Team: info.Team,
+		Maximum: info.Maximum,
+		Description: info.Description,
+		Notes: info.Notes,
+	}
+}
+
+func ReqSetup(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.SetupRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	response, aerr := start.GetGameSetup(start.GameSetupData{Players: request.Players})
+	if aerr != nil {
+		return aerr
+	}
+
+	cardInfo := make([]api.CardInfo, len(response.Cards))
+	for i, info := range response.Cards {
+		cardInfo[i] = make_card_info(info)
+	}
+
+	return write_json(w, &api.GameSetup{
+		Setup: make_setup(response.Setup),
+		GoodCards: response.GoodCards,
+		EvilCards: response.EvilCards,
+		Cards: cardInfo,
+	})
+}
+
+func ReqCheckCards(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.CheckCardsRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	response, aerr := start.CheckCards(start.GameCheckCardsData{
+		Players: request.Players,
+		Cards: request.Cards,
+		Suggest: request.Suggest,
+	})
+	if aerr != nil {
+		return aerr
+	}
+
+	return write_json(w, &api.CardCheck{Cards: response.Cards, Problems: response.Problems, Warnings: response.Warnings})
+}
+
+func ReqKnowledge(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.KnowledgeRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	knowledge, err := cards.GetKnowledge(request.Cards)
+	if err != nil {
+		return &web.AppError{err, err.Error(), 400}
+	}
+
+	response := api.Knowledge{Knowledge: make([]api.CardKnowledge, len(knowledge))}
+	for i, k := range knowledge {
+		reveals := make([]api.KnowledgeReveal, len(k.Reveals))
+		for j, reveal := range k.Reveals {
+			reveals[j] = api.KnowledgeReveal{Label: reveal.Label, Cards: reveal.Cards}
+		}
+		response.Knowledge[i] = api.CardKnowledge{Card: make_card_info(k.Card), Reveals: reveals, HiddenFrom: k.HiddenFrom}
+	}
+	return write_json(w, &response)
+}
+
+func ReqSeriesStart(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var request api.SeriesStartRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	pgame, mypos, aerr := start.StartSeries(c, session, start.SeriesStartData{
+		Participants: request.Players,
+		Cards: request.Cards,
+		BestOf: request.BestOf,
+		FixedSeating: request.FixedSeating,
+		RotateRoles: request.RotateRoles,
+	})
+	if aerr != nil {
+		return aerr
+	}
+
+	err = session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+
+	return write_state(w, c, *pgame, mypos)
+}
+
+func ReqSeriesNext(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	pgame, mypos, aerr := start.NextSeriesGame(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	err := session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+
+	return write_state(w, c, *pgame, mypos)
+}
+
+func ReqSeriesSummary(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	response, aerr := start.GetSeriesSummary(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	standings := make([]api.SeriesStanding, len(response.Standings))
+	for i, standing := range response.Standings {
+		standings[i] = api.SeriesStanding{
+			Name: standing.Name,
+			Score: standing.Score,
+			Played: standing.Played,
+			EvilCount: standing.EvilCount,
+		}
+	}
+
+	return write_json(w, &api.SeriesSummary{
+		Over: response.Over,
+		Standings: standings,
+		GoodWins: response.GoodWins,
+		EvilWins: response.EvilWins,
+	})
+}
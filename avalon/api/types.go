@@ -0,0 +1,272 @@
+package api
+
+import (
+	"time"
+)
+
+// The doc and enum tags on these types go into the OpenAPI document.
+
+type Session struct {
+	CSRFToken string `json:"csrf_token" doc:"Send this in an x-csrf-token header with every other request"`
+}
+
+// Some requests have nothing to answer with
+type Empty struct{}
+
+type LogInRequest struct {
+	Provider string `json:"provider,omitempty" doc:"The authentication provider, or the site's default if empty"`
+	Token string `json:"token,omitempty" doc:"For OpenID Connect providers, the ID token"`
+	Username string `json:"username,omitempty" doc:"For the password and dev providers"`
+	Password string `json:"password,omitempty" doc:"For the password provider"`
+}
+
+type GuestRequest struct {
+	Name string `json:"name,omitempty" doc:"Needed the first time; afterwards it renames the guest"`
+}
+
+type Guest struct {
+	Name string `json:"name"`
+}
+
+type CreateRoomRequest struct {
+	Name string `json:"name" doc:"Your name in the room and its games"`
+}
+
+type JoinRoomRequest struct {
+	Code string `json:"code" doc:"The room's code, from its invite link"`
+	Name string `json:"name" doc:"Your name in the room and its games"`
+}
+
+type ReadyRequest struct {
+	Ready bool `json:"ready"`
+}
+
+// The host's settings for the next game
+type RoomSettings struct {
+	Cards []string `json:"cards" doc:"The cards to play with, by label"`
+	AIs int `json:"ais" doc:"Seats to fill with AIs"`
+	Series bool `json:"series" doc:"Start a series of games rather than one"`
+	BestOf int `json:"best_of" doc:"How many games the series lasts, or 0 for no limit"`
+	FixedSeating bool `json:"fixed_seating" doc:"Keep the series' seating the same for each game"`
+	RotateRoles bool `json:"rotate_roles" doc:"Spread the evil roles evenly over the series"`
+}
+
+type LobbyPlayer struct {
+	Name string `json:"name"`
+	Ready bool `json:"ready"`
+	Host bool `json:"host" doc:"True for the player who picks the settings and starts games"`
+}
+
+type Room struct {
+	Code string `json:"code"`
+	Link string `json:"link" doc:"The invite link, which anybody can open to find the room"`
+	Players []LobbyPlayer `json:"players"`
+	Settings RoomSettings `json:"settings"`
+	AllReady bool `json:"all_ready"`
+	InGame bool `json:"in_game" doc:"True while a game is being played in the room; join it with /game/join"`
+}
+
+type ProposeRequest struct {
+	Mission int `json:"mission"`
+	Proposal int `json:"proposal"`
+	Players []int `json:"players" doc:"The seats on the team"`
+}
+
+type VoteRequest struct {
+	Mission int `json:"mission"`
+	Proposal int `json:"proposal"`
+	Vote string `json:"vote" enum:"approve,reject"`
+}
+
+type MissionRequest struct {
+	Mission int `json:"mission"`
+	Proposal int `json:"proposal"`
+	Action string `json:"action" doc:"One of the actions in MissionState.Actions" enum:"Success,Failure"`
+}
+
+type AssassinRequest struct {
+	Target int `json:"target" doc:"The seat to assassinate"`
+}
+
+type DecideRequest struct {
+	Decision int64 `json:"decision" doc:"The id of a pending decision"`
+	Choice int `json:"choice" doc:"One of the decision's players"`
+}
+
+type RematchRequest struct {
+	Accept *bool `json:"accept,omitempty" doc:"Leave this out to see how the rematch is going without answering"`
+}
+
+type Rematch struct {
+	Responses []string `json:"responses" doc:"Each seat's answer: accept, decline, or empty for no answer yet"`
+	Deadline time.Time `json:"deadline" doc:"When the rematch stops waiting for answers"`
+	Cancelled bool `json:"cancelled" doc:"The answers are in, and nobody but the AIs accepted"`
+	Started bool `json:"started"`
+	Joined bool `json:"joined" doc:"You have moved to the new game, and /game/state returns it"`
+}
+
+type SeriesStartRequest struct {
+	Players map[string]string `json:"players" doc:"Names to user ids. AIs are named ai_1, ai_2 and so on, with the user id ai"`
+	Cards []string `json:"cards" doc:"The cards to play with, by label"`
+	BestOf int `json:"best_of" doc:"How many games the series lasts, or 0 for no limit"`
+	FixedSeating bool `json:"fixed_seating" doc:"Keep the series' seating the same for each game"`
+	RotateRoles bool `json:"rotate_roles" doc:"Spread the evil roles evenly over the series"`
+}
+
+type SeriesStanding struct {
+	Name string `json:"name"`
+	Score int `json:"score"`
+	Played int `json:"played"`
+	EvilCount int `json:"evil_count" doc:"How many games the player has been evil in"`
+}
+
+type SeriesSummary struct {
+	Over bool `json:"over"`
+	Standings []SeriesStanding `json:"standings" doc:"Best first"`
+	GoodWins int `json:"good_wins"`
+	EvilWins int `json:"evil_wins"`
+}
+
+type SetupRequest struct {
+	Players int `json:"players"`
+}
+
+type CardInfo struct {
+	Label string `json:"label"`
+	Team string `json:"team" enum:"good,evil"`
+	Maximum int `json:"maximum" doc:"How many of the card a game can have"`
+	Description string `json:"description"`
+	Notes []string `json:"notes"`
+}
+
+type GameSetup struct {
+	Setup Setup `json:"setup"`
+	GoodCards []string `json:"good_cards"`
+	EvilCards []string `json:"evil_cards"`
+	Cards []CardInfo `json:"cards" doc:"Every card there is to choose from"`
+}
+
+type CheckCardsRequest struct {
+	Players int `json:"players"`
+	Cards []string `json:"cards"`
+	Suggest bool `json:"suggest" doc:"Fill the cards out with the standard ones before checking"`
+}
+
+type CardCheck struct {
+	Cards []string `json:"cards" doc:"The cards checked, after filling them out"`
+	Problems []string `json:"problems" doc:"A game can't start with these"`
+	Warnings []string `json:"warnings"`
+}
+
+type KnowledgeRequest struct {
+	Cards []string `json:"cards"`
+}
+
+type KnowledgeReveal struct {
+	Label string `json:"label"`
+	Cards []int `json:"cards" doc:"Indexes into the cards asked about"`
+}
+
+type CardKnowledge struct {
+	Card CardInfo `json:"card"`
+	Reveals []KnowledgeReveal `json:"reveals" doc:"What this card is shown at the start of the game"`
+	HiddenFrom []int `json:"hidden_from" doc:"The other cards which this card is hidden from"`
+}
+
+type Knowledge struct {
+	Knowledge []CardKnowledge `json:"knowledge" doc:"One for each card asked about, in the same order"`
+}
+
+type MissionSetup struct {
+	Size int `json:"size"`
+	FailsAllowed int `json:"fails_allowed"`
+}
+
+type Setup struct {
+	Missions []MissionSetup `json:"missions"`
+	Cards []string `json:"cards" doc:"The labels of the cards in play"`
+	Spies int `json:"spies"`
+}
+
+type MissionResult struct {
+	Mission int `json:"mission"`
+	Proposal int `json:"proposal" doc:"The proposal which went on the mission"`
+	Leader int `json:"leader"`
+	Players []int `json:"players"`
+	Fails int `json:"fails"`
+	FailsAllowed int `json:"fails_allowed"`
+}
+
+type VoteResult struct {
+	Vote int `json:"vote" doc:"This counts every vote in the game"`
+	Mission int `json:"mission"`
+	Proposal int `json:"proposal"`
+	Leader int `json:"leader"`
+	Players []int `json:"players" doc:"The seats on the proposed team"`
+	Votes []bool `json:"votes" doc:"Each seat's vote, true to approve"`
+}
+
+type Decision struct {
+	Id int64 `json:"id"`
+	Kind string `json:"kind"`
+	Label string `json:"label"`
+	Players []int `json:"players" doc:"The seats which may be chosen"`
+}
+
+type PickingState struct {
+	Size int `json:"size" doc:"How many players go on the mission"`
+	FailsAllowed int `json:"fails_allowed"`
+}
+
+type VotingState struct {
+	Players []int `json:"players" doc:"The seats on the proposed team"`
+	Voted []bool `json:"voted" doc:"Which seats have voted"`
+}
+
+type MissionState struct {
+	Players []int `json:"players" doc:"The seats on the mission"`
+	Acted []bool `json:"acted" doc:"Which of the players have acted, in the same order"`
+	Actions []string `json:"actions" doc:"The actions you may take, if you are on the mission"`
+}
+
+type AssassinationState struct {
+	Assassin int `json:"assassin"`
+	Cards []string `json:"cards" doc:"The card of each evil seat, and an empty string for the others"`
+}
+
+type GameOverState struct {
+	Winner string `json:"winner" enum:"good,evil"`
+	Won bool `json:"won" doc:"True if your side won"`
+	Result string `json:"result" doc:"How the game ended, for people"`
+	AssassinTarget int `json:"assassin_target" doc:"The seat the assassin chose, or -1"`
+	Cards []string `json:"cards" doc:"Every seat's card"`
+	Rematch string `json:"rematch,omitempty" doc:"The rematch's game id, once it has started. Players who accepted it move there with /game/join"`
+}
+
+// Exactly one of the phase's fields is set, the one named by Phase
+type GameState struct {
+	Game string `json:"game"`
+	Phase string `json:"phase" enum:"picking,voting,mission,assassination,game_over"`
+	Seat int `json:"seat" doc:"Your seat"`
+	Players []string `json:"players" doc:"The name in each seat"`
+	Setup Setup `json:"setup"`
+	Leader int `json:"leader"`
+	Mission int `json:"mission" doc:"The current mission"`
+	Proposal int `json:"proposal" doc:"The current proposal on that mission"`
+	Results []MissionResult `json:"results"`
+	Votes []VoteResult `json:"votes"`
+	Decisions []Decision `json:"decisions" doc:"Decisions you have yet to make"`
+
+	Picking *PickingState `json:"picking,omitempty"`
+	Voting *VotingState `json:"voting,omitempty"`
+	MissionState *MissionState `json:"mission_state,omitempty"`
+	Assassination *AssassinationState `json:"assassination,omitempty"`
+	GameOver *GameOverState `json:"game_over,omitempty"`
+}
+
+type Reveal struct {
+	Players []int `json:"players"`
+	Label string `json:"label" doc:"What the players have in common, such as Evil"`
+}
+
+type Reveals []Reveal
@@ -0,0 +1,26 @@
+package admin
+
+import (
+	"appengine"
+	"avalon/audit"
+	"avalon/web"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"net/http"
+)
+
+func init() {
+	http.Handle("/admin/audit", web.AppHandler(ReqAudit))
+}
+
+func ReqAudit(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	sets := audit.AllCardSets()
+	leaks := audit.Audit()
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "Audited %d card sets, found %d leaks\n", len(sets), len(leaks))
+	for _, leak := range leaks {
+		fmt.Fprintln(w, leak)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+// Package audit checks that no seat is shown anything which tells
+// apart cards it should not be able to. It is pure card logic, so the
+// tests run it on every build; /admin/audit runs it on the server.
+package audit
+
+import (
+	"avalon/data"
+	"avalon/data/cards"
+	"avalon/gameplay/view"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Leak is a case where a seat's view of the game changes when we
+// swap the cards of two other seats which it should not be able to
+// tell apart
+type Leak struct {
+	Cards []string
+	Seat int
+	Phase string
+	Swapped [2]int
+}
+
+func (leak Leak) String() string {
+	return fmt.Sprintf("%s: %s in seat %d can tell %s (seat %d) from %s (seat %d) - cards %s",
+		leak.Phase, leak.Cards[leak.Seat], leak.Seat,
+		leak.Cards[leak.Swapped[0]], leak.Swapped[0],
+		leak.Cards[leak.Swapped[1]], leak.Swapped[1],
+		strings.Join(leak.Cards, ","))
+}
+
+type phase struct {
+	Name string
+	// This returns what a seat is shown in this phase
+	View func(game data.Game, mypos int) interface{}
+	// This returns what everybody knows about a seat in this phase,
+	// beyond what their own reveals tell them
+	Public func(game data.Game, pos int) string
+}
+
+func nothingPublic(game data.Game, pos int) string {
+	return ""
+}
+
+func makeState(game data.Game, mypos int, proposal *data.Proposal, actions *data.Actions) interface{} {
+	playerids := make([]string, len(game.Roles))
+	for i := range playerids {
+		playerids[i] = fmt.Sprintf("player%d", i)
+	}
+	return view.MakeGameState(game, playerids, nil, proposal, actions, nil, nil, mypos)
+}
+
+func missionProposal(game data.Game) data.Proposal {
+	size := game.Setup.Missions[0].Size
+	proposal := data.Proposal{
+		Leader: 0,
+		Players: make([]int, size),
+		Votes: make([]bool, len(game.Roles)),
+		Voted: make([]bool, len(game.Roles)),
+	}
+	for i := range proposal.Players {
+		proposal.Players[i] = i
+	}
+	return proposal
+}
+
+var phases = []phase{
+	{
+		Name: "reveal",
+		View: func(game data.Game, mypos int) interface{} {
+			return view.GetGameReveal(game, mypos)
+		},
+		Public: nothingPublic,
+	},
+	{
+		Name: "picking",
+		View: func(game data.Game, mypos int) interface{} {
+			return makeState(game, mypos, nil, nil)
+		},
+		Public: nothingPublic,
+	},
+	{
+		Name: "voting",
+		View: func(game data.Game, mypos int) interface{} {
+			proposal := missionProposal(game)
+			return makeState(game, mypos, &proposal, nil)
+		},
+		Public: nothingPublic,
+	},
+	{
+		Name: "mission",
+		View: func(game data.Game, mypos int) interface{} {
+			proposal := missionProposal(game)
+			actions := data.Actions{
+				Actions: make([]bool, len(proposal.Players)),
+				Acted: make([]bool, len(proposal.Players)),
+			}
+			return makeState(game, mypos, &proposal, &actions)
+		},
+		Public: nothingPublic,
+	},
+	{
+		Name: "assassination",
+		View: func(game data.Game, mypos int) interface{} {
+			if game.FindAssassin() == -1 {
+				return nil
+			}
+			state := *game.State
+			state.GoodScore = 3
+			game.State = &state
+			return makeState(game, mypos, nil, nil)
+		},
+		// The evil players show their cards for the assassination
+		Public: func(game data.Game, pos int) string {
+			card := game.Cards[game.Roles[pos]]
+			if card.AllocatedAsSpy() {
+				return card.Label()
+			}
+			return "good"
+		},
+	},
+}
+
+func viewJSON(p phase, game data.Game, mypos int) []byte {
+	b, err := json.Marshal(p.View(game, mypos))
+	if err != nil {
+		panic("Cannot encode view: " + err.Error())
+	}
+	return b
+}
+
+// This returns, for each other seat, a signature of what mypos
+// legitimately knows about it: which of its reveals include the
+// seat, plus whatever is public. Seats with the same signature
+// should be indistinguishable.
+func knowledgeSignatures(p phase, game data.Game, mypos int) map[int]string {
+	reveals := view.GetGameReveal(game, mypos)
+	signatures := map[int]string{}
+	for pos := range game.Roles {
+		if pos == mypos {
+			continue
+		}
+		sig := []string{p.Public(game, pos)}
+		for i, reveal := range reveals {
+			for _, other := range reveal.Players {
+				if other == pos {
+					sig = append(sig, fmt.Sprint(i))
+				}
+			}
+		}
+		signatures[pos] = strings.Join(sig, "/")
+	}
+	return signatures
+}
+
+func swapRoles(game data.Game, a int, b int) data.Game {
+	roles := append([]int{}, game.Roles...)
+	roles[a], roles[b] = roles[b], roles[a]
+	game.Roles = roles
+	return game
+}
+
+func auditCardSet(labels []string) []Leak {
+	game, err := cards.MakeDummyGame(labels)
+	if err != nil {
+		panic("Cannot make dummy game: " + err.Error())
+	}
+
+	leaks := []Leak{}
+	for _, p := range phases {
+		for mypos := range game.Roles {
+			view := viewJSON(p, game, mypos)
+			signatures := knowledgeSignatures(p, game, mypos)
+			for a := range game.Roles {
+				for b := a + 1; b < len(game.Roles); b++ {
+					if a == mypos || b == mypos || signatures[a] != signatures[b] {
+						continue
+					}
+					if labels[a] == labels[b] {
+						continue
+					}
+					swapped := viewJSON(p, swapRoles(game, a, b), mypos)
+					if !bytes.Equal(view, swapped) {
+						leaks = append(leaks, Leak{labels, mypos, p.Name, [2]int{a, b}})
+					}
+				}
+			}
+		}
+	}
+	return leaks
+}
+
+// This returns every playable card set, for each number of players
+func AllCardSets() [][]string {
+	special := []string{}
+	for _, card := range cards.AllCards() {
+		if card.Maximum() > 0 {
+			special = append(special, card.Label())
+		}
+	}
+	sort.Strings(special)
+
+	seen := map[string]bool{}
+	sets := [][]string{}
+	for players := 5; players <= 10; players++ {
+		for mask := 0; mask < 1 << uint(len(special)); mask++ {
+			chosen := []string{}
+			for i, label := range special {
+				if mask & (1 << uint(i)) != 0 {
+					chosen = append(chosen, label)
+				}
+			}
+
+			labels, err := cards.FillCardSet(players, chosen)
+			if err != nil {
+				continue
+			}
+			problems, _ := cards.CheckCardSet(labels)
+			key := strings.Join(labels, ",")
+			if len(problems) > 0 || seen[key] {
+				continue
+			}
+			seen[key] = true
+			sets = append(sets, labels)
+		}
+	}
+	return sets
+}
+
+// This checks every playable card set for leaks
+func Audit() []Leak {
+	leaks := []Leak{}
+	for _, labels := range AllCardSets() {
+		leaks = append(leaks, auditCardSet(labels)...)
+	}
+	return leaks
+}
@@ -0,0 +1,23 @@
+package audit
+
+import (
+	"avalon/data/cards"
+	_ "avalon/data/cards/cleric"
+	"testing"
+)
+
+func TestNoLeaks(t *testing.T) {
+	err := cards.LoadCardDefinitions("../../cards.json")
+	if err != nil {
+		t.Fatal("Error loading card definitions: ", err)
+	}
+
+	sets := AllCardSets()
+	if len(sets) == 0 {
+		t.Fatal("No card sets to audit")
+	}
+
+	for _, leak := range Audit() {
+		t.Error(leak)
+	}
+}
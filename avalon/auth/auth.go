@@ -2,13 +2,13 @@ package auth
 
 import (
 	"appengine"
-	"appengine/urlfetch"
+	"avalon/api"
 	"avalon/data"
 	"avalon/web"
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/sessions"
 	"net/http"
-	"net/url"
     "log"
 	"text/template"
 )
@@ -19,32 +19,30 @@ func init() {
 	http.Handle("/auth/token", web.AjaxHandler(ReqAuthToken))
 }
 
-const (
-	avalonClientID = "834761542099-061td9hu3vl1mochrijcvrrt1e4egvq9.apps.googleusercontent.com"
-	avalonServerPath = "https://trim-mariner-422.appspot.com/"
-	avalonDevClientID = "834761542099-061td9hu3vl1mochrijcvrrt1e4egvq9.apps.googleusercontent.com"
-	avalonDevServerPath = "http://192.168.0.5:8080/"
-)
-
 var appjsTemplate = template.Must(template.ParseFiles("template/app.js"))
 
 type AuthData struct {
+	// Which Authenticator to use; see AuthConfig.DefaultProvider
+	Provider string `json:"provider"`
+	// For OIDC providers, the ID token
 	Token string `json:"token"`
+	// For the password and dev providers
+	Username string `json:"username"`
+	Password string `json:"password"`
+
 	MyId string `json:"myid"`
 	Hangout string `json:"hangout"`
 	HangoutUrl string `json:"hangouturl"`
 }
 
-type TokenInfo struct {
-	IssuedTo string `json:"issued_to"`
-	Audience string `json:"audience"`
-	UserId string `json:"user_id"`
-	Scope string `json:"scope"`
-	ExpiresIn int `json:"expires_in"`
-	AccessType string `json:"access_type"`
-}
-
 func make_ReqAppJS(w http.ResponseWriter, r *http.Request, session *sessions.Session, clientID string, serverPath string) *web.AppError {
+	// Checked first, so that a page we don't allow can't replace the
+	// session's state token
+	if !web.CheckOrigin(w, r) {
+		m := "Origin not allowed"
+		return &web.AppError{web.Coded(api.ErrOriginNotAllowed), m, 403}
+	}
+
 	// Create a state token to prevent request forgery and store it in the session
 	// for later validation
 	state := data.RandomString(64)
@@ -62,7 +60,6 @@ func make_ReqAppJS(w http.ResponseWriter, r *http.Request, session *sessions.Ses
 	}{clientID, stateURL, serverPath}
 
 	// Render and serve the HTML
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/javascript")
 	err = appjsTemplate.Execute(w, data)
 	if err != nil {
@@ -72,62 +69,81 @@ func make_ReqAppJS(w http.ResponseWriter, r *http.Request, session *sessions.Ses
 }
 
 func ReqAppJS(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
-	return make_ReqAppJS(w, r, session, avalonClientID, avalonServerPath)
+	return make_ReqAppJS(w, r, session, config.ClientID, web.Config.ServerPath)
 }
 
 func ReqAppDevJS(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
-	return make_ReqAppJS(w, r, session, avalonDevClientID, avalonDevServerPath)
+	return make_ReqAppJS(w, r, session, config.DevClientID, web.Config.DevServerPath)
 }
 
-func fetch_token_info(c appengine.Context, token string) (*TokenInfo, *web.AppError) {
-	client := urlfetch.Client(c)
-	addr := "https://www.googleapis.com/oauth2/v1/tokeninfo"
-	values := url.Values{
-		"access_token": {token},
-	}
-	resp, err := client.PostForm(addr, values)
+func ReqAuthToken(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var authdata AuthData
+	err := json.NewDecoder(r.Body).Decode(&authdata)
 	if err != nil {
-		return nil, &web.AppError{err, "Error validating access token", 500}
+		return web.JSONError(err)
 	}
-	defer resp.Body.Close()
 
-	var tokeninfo TokenInfo
-	err = json.NewDecoder(resp.Body).Decode(&tokeninfo)
-	if err != nil {
-		return nil, &web.AppError{err, "Error decoding tokeninfo", 500}
+	userID, aerr := Authenticate(c, authdata)
+	if aerr != nil {
+		return aerr
 	}
 
-	return &tokeninfo, nil
+	return log_in(w, r, session, userID, authdata)
 }
 
-func ReqAuthToken(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
-	var authdata AuthData
-	err := json.NewDecoder(r.Body).Decode(&authdata)
-	if err != nil {
-		return &web.AppError{err, "Error storing parsing json body", 500}
+// This checks a login's credentials with its provider, or the default
+// provider, and returns the user ID they prove
+func Authenticate(c appengine.Context, authdata AuthData) (string, *web.AppError) {
+	if authdata.Provider == "" {
+		authdata.Provider = config.DefaultProvider
+	}
+
+	authenticator, ok := GetAuthenticator(authdata.Provider)
+	if !ok {
+		m := "Unknown authentication provider " + authdata.Provider
+		return "", &web.AppError{errors.New(m), m, 400}
 	}
 
-	tokeninfo, aerr := fetch_token_info(c, authdata.Token)
+	return authenticator.Authenticate(c, authdata)
+}
+
+// This logs the session in, as /auth/token does, without writing a
+// response
+func LogIn(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, authdata AuthData) *web.AppError {
+	userID, aerr := Authenticate(c, authdata)
 	if aerr != nil {
 		return aerr
 	}
 
-	//log.Printf("Got userID %s and hangoutID %s", tokeninfo.UserId, authdata.Hangout)
-
-	session.Values["userID"] = tokeninfo.UserId
-	session.Values["participantID"] = authdata.MyId
-	session.Values["hangoutID"] = authdata.Hangout
+	start_session(w, r, session, userID, authdata)
+	return nil
+}
 
-	err = session.Save(r, w)
-	if err != nil {
-		log.Println("error saving session:", err)
-	}
+func log_in(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID string, authdata AuthData) *web.AppError {
+	start_session(w, r, session, userID, authdata)
 
 	w.Header().Set("Content-type", "application/json")
-	err = json.NewEncoder(w).Encode(&struct{}{})
+	err := json.NewEncoder(w).Encode(&struct{}{})
 	if err != nil {
 		return &web.AppError{err, "Error encoding json", 500}
 	}
 
 	return nil
 }
+
+func start_session(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID string, authdata AuthData) {
+	//log.Printf("Got userID %s and hangoutID %s", userID, authdata.Hangout)
+
+	session.Values["userID"] = userID
+	session.Values["participantID"] = authdata.MyId
+	// In a hangout, the hangout is the room; elsewhere players join
+	// rooms with /room/create or /room/join
+	if authdata.Hangout != "" {
+		session.Values["roomID"] = authdata.Hangout
+	}
+
+	err := session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+}
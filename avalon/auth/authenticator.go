@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"appengine"
+	"avalon/auth/verify"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// An Authenticator checks a login's credentials, and returns the user
+// ID they prove. Every provider's user IDs go in the same userID
+// session value, so they must not collide. Google's are bare, as they
+// always have been, and the other providers prefix theirs.
+type Authenticator interface {
+	Authenticate(c appengine.Context, authdata AuthData) (string, *web.AppError)
+}
+
+var authenticators = map[string]Authenticator{}
+
+func AddAuthenticator(name string, authenticator Authenticator) error {
+	if _, ok := authenticators[name]; ok {
+		return errors.New("Authentication provider " + name + " is defined twice")
+	}
+	authenticators[name] = authenticator
+	return nil
+}
+
+func GetAuthenticator(name string) (Authenticator, bool) {
+	authenticator, ok := authenticators[name]
+	return authenticator, ok
+}
+
+// A ProviderConfig is one entry in the providers of the auth config.
+// Which fields are used depends on Type.
+type ProviderConfig struct {
+	// "oidc", "password" or "dev"
+	Type string `json:"type"`
+
+	// OIDC: the accepted issuers and audiences, and where the keys
+	// come from - a JWKS URL, or the keys themselves
+	Issuers []string `json:"issuers"`
+	ClientIDs []string `json:"client_ids"`
+	JWKSURL string `json:"jwks_url"`
+	JWKS *verify.JSONWebKeySet `json:"jwks"`
+	// OIDC: prepended to the token's subject to make the user ID
+	UserPrefix string `json:"user_prefix"`
+}
+
+type AuthConfig struct {
+	// The Google client IDs that app.js signs in with
+	ClientID string `json:"client_id"`
+	DevClientID string `json:"dev_client_id"`
+	// Logins which don't say which provider they use get this one
+	DefaultProvider string `json:"default_provider"`
+	// Whether people can play as guests, without an account
+	Guests bool `json:"guests"`
+	Providers map[string]ProviderConfig `json:"providers"`
+}
+
+var config AuthConfig
+
+func makeAuthenticator(name string, provider ProviderConfig) (Authenticator, error) {
+	switch provider.Type {
+	case "oidc":
+		return NewOIDCAuthenticator(name, provider)
+	case "password":
+		return PasswordAuthenticator{}, nil
+	case "dev":
+		return DevAuthenticator{}, nil
+	}
+	return nil, errors.New("Authentication provider " + name + " has invalid type " + provider.Type)
+}
+
+// This reads the auth config, and registers an Authenticator for each
+// of its providers
+func LoadAuthConfig(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&config)
+	if err != nil {
+		return err
+	}
+
+	for name, provider := range config.Providers {
+		authenticator, err := makeAuthenticator(name, provider)
+		if err != nil {
+			return err
+		}
+		err = AddAuthenticator(name, authenticator)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, ok := authenticators[config.DefaultProvider]; !ok {
+		return errors.New("Default authentication provider " + config.DefaultProvider + " is not defined")
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"appengine"
+	"avalon/web"
+	"errors"
+)
+
+// The DevAuthenticator lets anybody log in as whoever they like, for
+// playing several players at once locally. It only works on the dev
+// server, whatever the config says.
+type DevAuthenticator struct{}
+
+func (DevAuthenticator) Authenticate(c appengine.Context, authdata AuthData) (string, *web.AppError) {
+	if !appengine.IsDevAppServer() {
+		m := "The dev provider only works on the dev server"
+		return "", &web.AppError{errors.New(m), m, 403}
+	}
+
+	if authdata.Username == "" {
+		m := "Need a username"
+		return "", &web.AppError{errors.New(m), m, 400}
+	}
+
+	return "dev:" + authdata.Username, nil
+}
@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+	"avalon/db"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"time"
+)
+
+func init() {
+	http.Handle("/auth/guest", web.AjaxHandler(ReqAuthGuest))
+	http.Handle("/auth/upgrade", web.AjaxHandler(ReqAuthUpgrade))
+}
+
+type GuestData struct {
+	// Needed the first time; afterwards it renames the guest
+	Name string `json:"name"`
+	MyId string `json:"myid"`
+	Hangout string `json:"hangout"`
+}
+
+type GuestResponse struct {
+	Name string `json:"name"`
+}
+
+func ValidateGuestName(name string) *web.AppError {
+	if name == "" || len(name) > 32 {
+		m := "Guest names are 1 to 32 characters"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+	return nil
+}
+
+// This returns the guest that the request's guest cookie is for, or
+// nil if it has none, even if it has become an account
+func find_guest(c appengine.Context, guestsession *sessions.Session) (*data.Guest, *web.AppError) {
+	guestID, _ := guestsession.Values["userID"].(string)
+	if guestID == "" {
+		return nil, nil
+	}
+
+	pguest, err := db.GetGuest(c, guestID)
+	if err != nil {
+		return nil, &web.AppError{err, "Error looking up guest", 500}
+	}
+	return pguest, nil
+}
+
+// This returns the guest that the request's guest cookie is for, or
+// nil if it has none
+func get_guest(c appengine.Context, guestsession *sessions.Session) (*data.Guest, *web.AppError) {
+	pguest, aerr := find_guest(c, guestsession)
+	if aerr != nil {
+		return nil, aerr
+	}
+	if pguest != nil && pguest.UpgradedTo != "" {
+		m := "This guest has become an account; log in to that instead"
+		return nil, &web.AppError{errors.New(m), m, 403}
+	}
+	return pguest, nil
+}
+
+// This logs in as the guest in the guest cookie, or makes a new guest
+// and sets the cookie
+func ReqAuthGuest(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var guestdata GuestData
+	err := json.NewDecoder(r.Body).Decode(&guestdata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	guest, aerr := LogInAsGuest(w, r, c, session, guestdata)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err = json.NewEncoder(w).Encode(&GuestResponse{guest.Name})
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
+
+// This logs the session in as the guest in the guest cookie, or a new
+// guest, without writing a response
+func LogInAsGuest(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, guestdata GuestData) (*data.Guest, *web.AppError) {
+	if !config.Guests {
+		m := "Guests are not allowed"
+		return nil, &web.AppError{errors.New(m), m, 403}
+	}
+
+	guestsession, _ := web.GuestStore.Get(r, "guest")
+	pguest, aerr := get_guest(c, guestsession)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	var guest data.Guest
+	if pguest == nil {
+		aerr = ValidateGuestName(guestdata.Name)
+		if aerr != nil {
+			return nil, aerr
+		}
+		guest = data.Guest{
+			UserID: data.GuestPrefix + data.RandomString(32),
+			Name: guestdata.Name,
+			Created: time.Now(),
+		}
+	} else {
+		guest = *pguest
+		if guestdata.Name != "" {
+			aerr = ValidateGuestName(guestdata.Name)
+			if aerr != nil {
+				return nil, aerr
+			}
+			guest.Name = guestdata.Name
+		}
+	}
+
+	err := db.StoreGuest(c, guest)
+	if err != nil {
+		return nil, &web.AppError{err, "Error storing guest", 500}
+	}
+
+	guestsession.Values["userID"] = guest.UserID
+	err = guestsession.Save(r, w)
+	if err != nil {
+		log.Println("error saving guest cookie:", err)
+	}
+
+	start_session(w, r, session, guest.UserID, AuthData{MyId: guestdata.MyId, Hangout: guestdata.Hangout})
+	return &guest, nil
+}
+
+func move_rating(c appengine.Context, rating data.Rating, userID string) error {
+	return datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		existing, err := db.GetRating(tc, rating.Scope, userID)
+		if err != nil {
+			return err
+		}
+		// Two Elo ratings can't be combined, so the account's own
+		// rating wins
+		if existing == nil {
+			moved := rating
+			moved.UserID = userID
+			moved.Guest = false
+			err = db.StoreRating(tc, moved)
+			if err != nil {
+				return err
+			}
+		}
+		return db.DeleteRating(tc, rating)
+	}, &datastore.TransactionOptions{XG: true})
+}
+
+func move_achievement(c appengine.Context, achievement data.Achievement, userID string) error {
+	return datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		existing, err := db.GetAchievement(tc, userID, achievement.Id)
+		if err != nil {
+			return err
+		}
+
+		merged := achievement
+		merged.UserID = userID
+		if existing != nil {
+			merged = *existing
+			merged.Count += achievement.Count
+			if achievement.FirstTime.Before(merged.FirstTime) {
+				merged.FirstGame = achievement.FirstGame
+				merged.FirstTime = achievement.FirstTime
+			}
+			if achievement.LastTime.After(merged.LastTime) {
+				merged.LastGame = achievement.LastGame
+				merged.LastTime = achievement.LastTime
+			}
+		}
+
+		err = db.StoreAchievement(tc, merged)
+		if err != nil {
+			return err
+		}
+		return db.DeleteAchievement(tc, achievement)
+	}, &datastore.TransactionOptions{XG: true})
+}
+
+// This marks the guest as having become the account, unless it has
+// become another. With store unset it only checks.
+func mark_upgraded(c appengine.Context, guestID string, userID string, store bool) *web.AppError {
+	var aerr *web.AppError
+	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		aerr = nil
+		pguest, err := db.GetGuest(tc, guestID)
+		if err != nil {
+			return err
+		}
+		if pguest == nil {
+			m := "No such guest"
+			aerr = &web.AppError{errors.New(m), m, 404}
+			return nil
+		}
+		if pguest.UpgradedTo != "" && pguest.UpgradedTo != userID {
+			m := "This guest has already become another account"
+			aerr = &web.AppError{errors.New(m), m, 409}
+			return nil
+		}
+		if !store || pguest.UpgradedTo == userID {
+			return nil
+		}
+		pguest.UpgradedTo = userID
+		return db.StoreGuest(tc, *pguest)
+	}, nil)
+	if err != nil {
+		return &web.AppError{err, "Error upgrading guest", 500}
+	}
+	return aerr
+}
+
+// This moves everything a guest has done to an account: their seats in
+// games, rooms and series, their ratings and their achievements. Each
+// step stands alone, so if it fails part way it can be run again. The
+// guest is only marked as upgraded, which stops it logging in, once
+// everything has moved.
+func UpgradeGuest(c appengine.Context, guestID string, userID string) *web.AppError {
+	aerr := mark_upgraded(c, guestID, userID, false)
+	if aerr != nil {
+		return aerr
+	}
+
+	finders := []func(appengine.Context, string) ([]*datastore.Key, error){db.GamesWithUser, db.RoomsWithUser, db.SeriesWithUser}
+	for _, finder := range finders {
+		keys, err := finder(c, guestID)
+		if err != nil {
+			return &web.AppError{err, "Error finding guest's games", 500}
+		}
+		for _, key := range keys {
+			err = datastore.RunInTransaction(c, func(tc appengine.Context) error {
+				return db.ReplaceUserID(tc, key, guestID, userID)
+			}, nil)
+			if err != nil {
+				return &web.AppError{err, "Error moving guest's games", 500}
+			}
+		}
+	}
+
+	ratings, err := db.GetPlayerRatings(c, guestID)
+	if err != nil {
+		return &web.AppError{err, "Error retrieving guest's ratings", 500}
+	}
+	for _, rating := range ratings {
+		err = move_rating(c, rating, userID)
+		if err != nil {
+			return &web.AppError{err, "Error moving guest's ratings", 500}
+		}
+	}
+
+	achievements, err := db.GetAchievements(c, guestID)
+	if err != nil {
+		return &web.AppError{err, "Error retrieving guest's achievements", 500}
+	}
+	for _, achievement := range achievements {
+		err = move_achievement(c, achievement, userID)
+		if err != nil {
+			return &web.AppError{err, "Error moving guest's achievements", 500}
+		}
+	}
+
+	return mark_upgraded(c, guestID, userID, true)
+}
+
+// This logs in to an account, as /auth/token does, and moves the
+// guest in the guest cookie to it
+func ReqAuthUpgrade(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var authdata AuthData
+	err := json.NewDecoder(r.Body).Decode(&authdata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+	if authdata.Provider == "" {
+		authdata.Provider = config.DefaultProvider
+	}
+
+	// A guest already marked as this account is let through, in case
+	// clearing the cookie failed last time; UpgradeGuest turns away any
+	// other account
+	guestsession, _ := web.GuestStore.Get(r, "guest")
+	pguest, aerr := find_guest(c, guestsession)
+	if aerr != nil {
+		return aerr
+	}
+	if pguest == nil {
+		m := "Not a guest"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	authenticator, ok := GetAuthenticator(authdata.Provider)
+	if !ok {
+		m := "Unknown authentication provider " + authdata.Provider
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	userID, aerr := authenticator.Authenticate(c, authdata)
+	if aerr != nil {
+		return aerr
+	}
+
+	aerr = UpgradeGuest(c, pguest.UserID, userID)
+	if aerr != nil {
+		return aerr
+	}
+
+	delete(guestsession.Values, "userID")
+	guestsession.Options = &sessions.Options{Path: "/", MaxAge: -1}
+	err = guestsession.Save(r, w)
+	if err != nil {
+		log.Println("error saving guest cookie:", err)
+	}
+
+	return log_in(w, r, session, userID, authdata)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"appengine"
+	"appengine/urlfetch"
+	"avalon/auth/verify"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// How long fetched keys are used for, and how soon they can be
+	// fetched again when a token is signed with a key we don't have
+	jwksLifetime = time.Hour
+	jwksMinRefresh = time.Minute
+)
+
+// An OIDCAuthenticator checks OpenID Connect ID tokens itself, with the
+// issuer's keys, rather than asking the issuer about each login
+type OIDCAuthenticator struct {
+	name string
+	config ProviderConfig
+
+	// Keys fetched from config.JWKSURL, shared by this instance's
+	// requests
+	mutex sync.Mutex
+	keys verify.JSONWebKeySet
+	fetched time.Time
+}
+
+func NewOIDCAuthenticator(name string, provider ProviderConfig) (*OIDCAuthenticator, error) {
+	if len(provider.Issuers) == 0 || len(provider.ClientIDs) == 0 {
+		return nil, errors.New("Authentication provider " + name + " needs issuers and client IDs")
+	}
+	if provider.JWKS == nil && provider.JWKSURL == "" {
+		return nil, errors.New("Authentication provider " + name + " needs keys or a JWKS URL")
+	}
+	return &OIDCAuthenticator{name: name, config: provider}, nil
+}
+
+func fetch_jwks(c appengine.Context, url string) (*verify.JSONWebKeySet, error) {
+	client := urlfetch.Client(c)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Fetching keys returned " + resp.Status)
+	}
+
+	var keys verify.JSONWebKeySet
+	err = json.NewDecoder(resp.Body).Decode(&keys)
+	if err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// This returns the keys to check tokens with. With refresh set, keys
+// from a URL are fetched again unless they were fetched very recently.
+func (a *OIDCAuthenticator) getKeys(c appengine.Context, refresh bool) (verify.JSONWebKeySet, error) {
+	if a.config.JWKS != nil {
+		return *a.config.JWKS, nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	age := time.Since(a.fetched)
+	if age < jwksLifetime && !(refresh && age > jwksMinRefresh) {
+		return a.keys, nil
+	}
+
+	keys, err := fetch_jwks(c, a.config.JWKSURL)
+	if err != nil {
+		return a.keys, err
+	}
+	a.keys = *keys
+	a.fetched = time.Now()
+	return a.keys, nil
+}
+
+func (a *OIDCAuthenticator) ValidateClaims(claims verify.JWTClaims) error {
+	return verify.Claims(claims, a.config.Issuers, a.config.ClientIDs, time.Now())
+}
+
+func (a *OIDCAuthenticator) Authenticate(c appengine.Context, authdata AuthData) (string, *web.AppError) {
+	if authdata.Token == "" {
+		m := "Need an ID token"
+		return "", &web.AppError{errors.New(m), m, 400}
+	}
+
+	keys, err := a.getKeys(c, false)
+	if err != nil && len(keys.Keys) == 0 {
+		return "", &web.AppError{err, "Error fetching keys for " + a.name, 500}
+	}
+
+	claims, err := verify.JWT(authdata.Token, keys)
+	if err != nil {
+		// The issuer may have rotated its keys
+		keys, kerr := a.getKeys(c, true)
+		if kerr != nil {
+			c.Warningf("Error fetching keys for %s: %s", a.name, kerr)
+		}
+		claims, err = verify.JWT(authdata.Token, keys)
+	}
+	if err != nil {
+		return "", &web.AppError{err, "Invalid ID token", 403}
+	}
+
+	err = a.ValidateClaims(*claims)
+	if err != nil {
+		return "", &web.AppError{err, err.Error(), 403}
+	}
+
+	return a.config.UserPrefix + claims.Subject, nil
+}
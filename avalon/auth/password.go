@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/api"
+	"avalon/auth/verify"
+	"avalon/data"
+	"avalon/db"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	http.Handle("/auth/register", web.AjaxHandler(ReqAuthRegister))
+}
+
+const minPasswordLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+// Checked against when there is no such user, so that logging in takes
+// as long either way
+var dummyHash = verify.HashPassword("")
+
+// The PasswordAuthenticator logs in accounts made with /auth/register
+type PasswordAuthenticator struct{}
+
+func (PasswordAuthenticator) Authenticate(c appengine.Context, authdata AuthData) (string, *web.AppError) {
+	puser, err := db.GetPasswordUser(c, authdata.Username)
+	if err != nil {
+		return "", &web.AppError{err, "Error looking up user", 500}
+	}
+
+	hash := dummyHash
+	if puser != nil {
+		hash = puser.Hash
+	}
+	if !verify.Password(hash, authdata.Password) || puser == nil {
+		m := "Wrong username or password"
+		return "", &web.AppError{web.Coded(api.ErrBadCredentials), m, 403}
+	}
+
+	return puser.UserID, nil
+}
+
+func ValidateRegister(authdata AuthData) *web.AppError {
+	authenticator, _ := GetAuthenticator(authdata.Provider)
+	if _, ok := authenticator.(PasswordAuthenticator); !ok {
+		m := "Cannot register with provider " + authdata.Provider
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	if !usernamePattern.MatchString(authdata.Username) {
+		m := "Usernames are 3 to 32 letters, digits, dots, dashes and underscores"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	if len(authdata.Password) < minPasswordLength {
+		m := "Passwords must be at least " + strconv.Itoa(minPasswordLength) + " characters"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	return nil
+}
+
+// This makes a new password account and logs in with it
+func ReqAuthRegister(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var authdata AuthData
+	err := json.NewDecoder(r.Body).Decode(&authdata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+	if authdata.Provider == "" {
+		authdata.Provider = "password"
+	}
+
+	aerr := ValidateRegister(authdata)
+	if aerr != nil {
+		return aerr
+	}
+
+	user := data.PasswordUser{
+		Username: authdata.Username,
+		Hash: verify.HashPassword(authdata.Password),
+		UserID: "password:" + strings.ToLower(authdata.Username),
+		Created: time.Now(),
+	}
+	err = datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		aerr = nil
+		olduser, err := db.GetPasswordUser(tc, user.Username)
+		if err != nil {
+			return err
+		}
+		if olduser != nil {
+			m := "That username is taken"
+			aerr = &web.AppError{errors.New(m), m, 409}
+			return nil
+		}
+		return db.StorePasswordUser(tc, user)
+	}, nil)
+	if err != nil {
+		return &web.AppError{err, "Error storing user", 500}
+	}
+	if aerr != nil {
+		return aerr
+	}
+
+	return log_in(w, r, session, user.UserID, authdata)
+}
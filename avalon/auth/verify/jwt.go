@@ -0,0 +1,194 @@
+// Package verify checks credentials: ID tokens signed by an OIDC
+// provider, and password hashes. It doesn't use App Engine, so it can
+// be tested on its own.
+package verify
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Seconds of clock difference allowed with the token's issuer
+const ClockLeeway = 60
+
+// A JSONWebKey is one key of a JWKS document. Only RSA keys are used.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N string `json:"n"`
+	E string `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// These are the claims that are checked. Audience may be a string or a
+// list, so it is decoded separately.
+type JWTClaims struct {
+	Issuer string `json:"iss"`
+	Subject string `json:"sub"`
+	Expires int64 `json:"exp"`
+	IssuedAt int64 `json:"iat"`
+	Audience []string `json:"-"`
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+}
+
+func (key JSONWebKey) publicKey() (*rsa.PublicKey, error) {
+	if key.Kty != "RSA" {
+		return nil, errors.New("Unsupported key type " + key.Kty)
+	}
+	n, err := decodeSegment(key.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeSegment(key.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1 << 31 {
+		return nil, errors.New("Invalid key exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func decodeAudience(payload []byte) ([]string, error) {
+	var aud struct {
+		Aud json.RawMessage `json:"aud"`
+	}
+	err := json.Unmarshal(payload, &aud)
+	if err != nil || len(aud.Aud) == 0 {
+		return nil, err
+	}
+
+	var one string
+	if json.Unmarshal(aud.Aud, &one) == nil {
+		return []string{one}, nil
+	}
+	var many []string
+	err = json.Unmarshal(aud.Aud, &many)
+	return many, err
+}
+
+// This checks the signature of a compact JWT against the key set, and
+// returns its claims. Only RS256 is accepted, so a token can't choose a
+// weaker algorithm (or none). The claims are checked by Claims.
+func JWT(token string, keys JSONWebKeySet) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed token")
+	}
+
+	headerJSON, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var header jwtHeader
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, errors.New("Unsupported token algorithm " + header.Alg)
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	verified := false
+	for _, key := range keys.Keys {
+		if header.Kid != "" && key.Kid != header.Kid {
+			continue
+		}
+		if key.Alg != "" && key.Alg != header.Alg {
+			continue
+		}
+		pub, err := key.publicKey()
+		if err != nil {
+			continue
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("Token signature does not match any key")
+	}
+
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims JWTClaims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, err
+	}
+	claims.Audience, err = decodeAudience(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// This checks that the claims are from one of the issuers, for one of
+// the audiences, and current at now
+func Claims(claims JWTClaims, issuers []string, audiences []string, now time.Time) error {
+	if !contains(issuers, claims.Issuer) {
+		return errors.New("Token is from the wrong issuer")
+	}
+
+	audience := false
+	for _, aud := range claims.Audience {
+		if contains(audiences, aud) {
+			audience = true
+		}
+	}
+	if !audience {
+		return errors.New("Token is for a different client")
+	}
+
+	unix := now.Unix()
+	if claims.Expires == 0 || unix > claims.Expires + ClockLeeway {
+		return errors.New("Token has expired")
+	}
+	if claims.IssuedAt > unix + ClockLeeway {
+		return errors.New("Token was issued in the future")
+	}
+
+	if claims.Subject == "" {
+		return errors.New("Token has no subject")
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey *rsa.PrivateKey
+
+func init() {
+	var err error
+	testKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func encodeSegment(data string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(data))
+}
+
+func testKeySet(kid string) JSONWebKeySet {
+	return JSONWebKeySet{[]JSONWebKey{{
+		Kty: "RSA",
+		Kid: kid,
+		Alg: "RS256",
+		N: base64.RawURLEncoding.EncodeToString(testKey.N.Bytes()),
+		E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(testKey.E)).Bytes()),
+	}}}
+}
+
+func signRS256(header string, payload string) string {
+	signed := encodeSegment(header) + "." + encodeSegment(payload)
+	hash := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, testKey, crypto.SHA256, hash[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+const (
+	testHeader = `{"alg":"RS256","kid":"key1"}`
+	testPayload = `{"iss":"https://issuer","sub":"1234","aud":"client","exp":2000000000,"iat":1000000000}`
+)
+
+func TestJWTValid(t *testing.T) {
+	claims, err := JWT(signRS256(testHeader, testPayload), testKeySet("key1"))
+	if err != nil {
+		t.Fatal("Valid token rejected: ", err)
+	}
+	if claims.Issuer != "https://issuer" || claims.Subject != "1234" || claims.Expires != 2000000000 {
+		t.Errorf("Wrong claims %+v", *claims)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "client" {
+		t.Errorf("Wrong audience %v", claims.Audience)
+	}
+}
+
+func TestJWTTamperedPayload(t *testing.T) {
+	parts := strings.Split(signRS256(testHeader, testPayload), ".")
+	parts[1] = encodeSegment(strings.Replace(testPayload, "1234", "5678", 1))
+	_, err := JWT(strings.Join(parts, "."), testKeySet("key1"))
+	if err == nil {
+		t.Error("Tampered payload accepted")
+	}
+}
+
+func TestJWTAlgNone(t *testing.T) {
+	token := encodeSegment(`{"alg":"none","kid":"key1"}`) + "." + encodeSegment(testPayload) + "."
+	_, err := JWT(token, testKeySet("key1"))
+	if err == nil {
+		t.Error("Unsigned token accepted")
+	}
+}
+
+func TestJWTAlgHS256(t *testing.T) {
+	// Signed with the public key as an HMAC secret, which is what a
+	// verifier that trusts the header's alg would check it with
+	keys := testKeySet("key1")
+	signed := encodeSegment(`{"alg":"HS256","kid":"key1"}`) + "." + encodeSegment(testPayload)
+	mac := hmac.New(sha256.New, []byte(keys.Keys[0].N))
+	mac.Write([]byte(signed))
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	_, err := JWT(token, keys)
+	if err == nil {
+		t.Error("HS256 token accepted")
+	}
+}
+
+func TestJWTWrongKid(t *testing.T) {
+	_, err := JWT(signRS256(testHeader, testPayload), testKeySet("key2"))
+	if err == nil {
+		t.Error("Token accepted with a key of another kid")
+	}
+}
+
+func testClaims() JWTClaims {
+	return JWTClaims{
+		Issuer: "https://issuer",
+		Subject: "1234",
+		Expires: 2000000000,
+		IssuedAt: 1000000000,
+		Audience: []string{"client"},
+	}
+}
+
+func TestClaims(t *testing.T) {
+	issuers := []string{"https://issuer"}
+	audiences := []string{"client"}
+	now := time.Unix(1500000000, 0)
+
+	err := Claims(testClaims(), issuers, audiences, now)
+	if err != nil {
+		t.Error("Valid claims rejected: ", err)
+	}
+
+	expired := testClaims()
+	expired.Expires = now.Unix() - ClockLeeway - 1
+	if Claims(expired, issuers, audiences, now) == nil {
+		t.Error("Expired claims accepted")
+	}
+
+	noexpiry := testClaims()
+	noexpiry.Expires = 0
+	if Claims(noexpiry, issuers, audiences, now) == nil {
+		t.Error("Claims with no expiry accepted")
+	}
+
+	future := testClaims()
+	future.IssuedAt = now.Unix() + ClockLeeway + 1
+	if Claims(future, issuers, audiences, now) == nil {
+		t.Error("Claims from the future accepted")
+	}
+
+	if Claims(testClaims(), issuers, []string{"other"}, now) == nil {
+		t.Error("Claims for another audience accepted")
+	}
+
+	noaudience := testClaims()
+	noaudience.Audience = nil
+	if Claims(noaudience, issuers, audiences, now) == nil {
+		t.Error("Claims with no audience accepted")
+	}
+
+	if Claims(testClaims(), []string{"https://other"}, audiences, now) == nil {
+		t.Error("Claims from another issuer accepted")
+	}
+}
+
+func TestJWTAudienceList(t *testing.T) {
+	payload := strings.Replace(testPayload, `"aud":"client"`, `"aud":["other","client"]`, 1)
+	claims, err := JWT(signRS256(testHeader, payload), testKeySet("key1"))
+	if err != nil {
+		t.Fatal("Valid token rejected: ", err)
+	}
+	err = Claims(*claims, []string{"https://issuer"}, []string{"client"}, time.Unix(1500000000, 0))
+	if err != nil {
+		t.Error("Audience list rejected: ", err)
+	}
+}
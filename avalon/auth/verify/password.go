@@ -0,0 +1,84 @@
+package verify
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+const (
+	PasswordIterations = 600000
+	passwordSaltLength = 16
+	passwordKeyLength = 32
+)
+
+// This is PBKDF2 (RFC 2898) with HMAC-SHA256
+func PBKDF2(password []byte, salt []byte, iterations int, keyLength int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLength := prf.Size()
+	blocks := (keyLength + hashLength - 1) / hashLength
+
+	key := make([]byte, 0, blocks * hashLength)
+	u := make([]byte, hashLength)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		key = prf.Sum(key)
+		t := key[len(key) - hashLength:]
+		copy(u, t)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+	return key[:keyLength]
+}
+
+// This hashes a password with a new salt. The hash records its
+// iteration count, so raising PasswordIterations leaves older hashes
+// working.
+func HashPassword(password string) string {
+	salt := make([]byte, passwordSaltLength)
+	rand.Read(salt)
+	key := PBKDF2([]byte(password), salt, PasswordIterations, passwordKeyLength)
+	return strings.Join([]string{
+		"pbkdf2-sha256",
+		strconv.Itoa(PasswordIterations),
+		base64.StdEncoding.EncodeToString(salt),
+		base64.StdEncoding.EncodeToString(key),
+	}, "$")
+}
+
+// This checks a password against a hash from HashPassword
+func Password(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	key := PBKDF2([]byte(password), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
+
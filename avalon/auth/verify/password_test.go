@@ -0,0 +1,50 @@
+package verify
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// From RFC 7914, section 11
+var pbkdf2Vectors = []struct {
+	password string
+	salt string
+	iterations int
+	key string
+}{
+	{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+	{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+}
+
+func TestPBKDF2(t *testing.T) {
+	for _, v := range pbkdf2Vectors {
+		want, _ := hex.DecodeString(v.key)
+		key := PBKDF2([]byte(v.password), []byte(v.salt), v.iterations, len(want))
+		if hex.EncodeToString(key) != v.key {
+			t.Errorf("PBKDF2(%q, %q, %d) = %x, want %s", v.password, v.salt, v.iterations, key, v.key)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	hash := HashPassword("correct horse")
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$600000$") {
+		t.Errorf("Unexpected hash format %s", hash)
+	}
+	if !Password(hash, "correct horse") {
+		t.Error("Password does not match its own hash")
+	}
+	if Password(hash, "battery staple") {
+		t.Error("Wrong password matches")
+	}
+	if HashPassword("correct horse") == hash {
+		t.Error("Hashes are not salted")
+	}
+
+	// Hashes made with fewer iterations still work
+	old := "pbkdf2-sha256$1$c2FsdA==$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLw="
+	if !Password(old, "passwd") {
+		t.Error("Old hash does not match")
+	}
+}
@@ -1,10 +1,36 @@
 package avalon
 
 import (
+	"avalon/achievements"
+	"avalon/auth"
+	"avalon/web"
+	"avalon/data/cards"
 	"time"
 	mathrand "math/rand"
 )
 
 func init() {
 	mathrand.Seed( time.Now().UTC().UnixNano())
+
+	// Cards with no special mechanics are defined here rather than in go
+	err := cards.LoadCardDefinitions("cards.json")
+	if err != nil {
+		panic("Error loading card definitions: " + err.Error())
+	}
+
+	// Achievements refer to cards by label, so these go second
+	err = achievements.LoadAchievementDefinitions("achievements.json")
+	if err != nil {
+		panic("Error loading achievement definitions: " + err.Error())
+	}
+
+	err = auth.LoadAuthConfig("auth.json")
+	if err != nil {
+		panic("Error loading auth config: " + err.Error())
+	}
+
+	err = web.LoadWebConfig("web.json")
+	if err != nil {
+		panic("Error loading web config: " + err.Error())
+	}
 }
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"avalon/api"
+)
+
+// These describe the cards, for choosing a room's settings
+
+// This returns the missions for a game with this many players, and the
+// cards there are to choose from
+func (client *Client) GameSetup(players int) (api.GameSetup, error) {
+	var setup api.GameSetup
+	err := client.post(api.Prefix + "/game/setup", api.SetupRequest{Players: players}, &setup)
+	return setup, err
+}
+
+// This checks a set of cards for a game with this many players. With
+// suggest set, the cards are first filled out with the standard ones.
+func (client *Client) CheckCards(players int, cards []string, suggest bool) (api.CardCheck, error) {
+	var check api.CardCheck
+	err := client.post(api.Prefix + "/game/checkcards", api.CheckCardsRequest{Players: players, Cards: cards, Suggest: suggest}, &check)
+	return check, err
+}
+
+// This works out who sees whom with a set of cards
+func (client *Client) Knowledge(cards []string) (api.Knowledge, error) {
+	var knowledge api.Knowledge
+	err := client.post(api.Prefix + "/game/knowledge", api.KnowledgeRequest{Cards: cards}, &knowledge)
+	return knowledge, err
+}
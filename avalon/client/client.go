@@ -0,0 +1,139 @@
+// Package client talks to the game API for bots and tools written in
+// Go. It keeps the session cookie and CSRF token, and wraps the v1
+// endpoints (see avalon/api) for logging in, rooms, choosing cards,
+// games, rematches and series.
+//
+// Game states come back as an api.GameState, whose Phase says which of
+// its Picking, Voting, MissionState, Assassination and GameOver fields
+// is set, in place of the different type per phase which /game/state
+// returns.
+//
+// Like avalon/api, this only depends on the standard library, and so
+// works outside App Engine.
+package client
+
+import (
+	"avalon/api"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+)
+
+type Client struct {
+	// The site, such as https://example.appspot.com
+	Server string
+	// This must have a cookie jar, for the session
+	HTTP *http.Client
+
+	csrfToken string
+}
+
+func New(server string) *Client {
+	// This only fails for bad options
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		Server: strings.TrimSuffix(server, "/"),
+		HTTP: &http.Client{Jar: jar},
+	}
+}
+
+// An Error is a request the server turned down
+type Error api.Error
+
+func (e *Error) Error() string {
+	return e.Message + " (" + e.Code + ")"
+}
+
+// This is true if err is an Error with the code given, one of the
+// api.Err constants
+func HasCode(err error, code string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == code
+}
+
+var ErrNoSession = errors.New("No session: call StartSession first")
+
+// This POSTs the request as JSON, and decodes the response into
+// response unless that is nil
+func (client *Client) post(path string, request interface{}, response interface{}) error {
+	if client.csrfToken == "" && path != api.Prefix + "/session" {
+		return ErrNoSession
+	}
+
+	if request == nil {
+		request = struct{}{}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", client.Server + path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client.csrfToken != "" {
+		req.Header.Set("x-csrf-token", client.csrfToken)
+	}
+
+	resp, err := client.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		e := &Error{}
+		err = json.Unmarshal(message, e)
+		if err != nil || e.Code == "" {
+			// Not from one of our handlers, such as a proxy's error page
+			code, ok := api.StatusCodes[resp.StatusCode]
+			if !ok {
+				code = api.ErrInternal
+			}
+			e = &Error{Code: code, Message: strings.TrimSpace(string(message)), Status: resp.StatusCode}
+		}
+		return e
+	}
+
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// This must be called before anything else
+func (client *Client) StartSession() error {
+	var session api.Session
+	err := client.post(api.Prefix + "/session", nil, &session)
+	if err != nil {
+		return err
+	}
+	client.csrfToken = session.CSRFToken
+	return nil
+}
+
+// This logs in with a username and password, for the password and
+// dev providers. An empty provider means the site's default.
+func (client *Client) LogIn(provider string, username string, password string) error {
+	return client.post(api.Prefix + "/auth/token", api.LogInRequest{Provider: provider, Username: username, Password: password}, nil)
+}
+
+// This logs in with an ID token, for OIDC providers
+func (client *Client) LogInWithToken(provider string, token string) error {
+	return client.post(api.Prefix + "/auth/token", api.LogInRequest{Provider: provider, Token: token}, nil)
+}
+
+// This logs in as a guest. Guests are remembered by a cookie, so the
+// same Client stays the same guest.
+func (client *Client) LogInAsGuest(name string) (api.Guest, error) {
+	var guest api.Guest
+	err := client.post(api.Prefix + "/auth/guest", api.GuestRequest{Name: name}, &guest)
+	return guest, err
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"avalon/api"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// This starts a server which gives out a session, and answers
+// everything else with handler
+func start_server(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *Client) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(api.Prefix + "/session", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&api.Session{CSRFToken: "token"})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-csrf-token") != "token" {
+			t.Errorf("%s sent without the CSRF token", r.URL.Path)
+		}
+		handler(w, r)
+	})
+	server := httptest.NewServer(mux)
+
+	client := New(server.URL)
+	err := client.StartSession()
+	if err != nil {
+		server.Close()
+		t.Fatal("Error starting session: ", err)
+	}
+	return server, client
+}
+
+func TestNoSession(t *testing.T) {
+	client := New("http://localhost")
+	_, err := client.State()
+	if err != ErrNoSession {
+		t.Errorf("State without a session: got %v, want ErrNoSession", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		status int
+		body string
+		want Error
+	}{
+		{"API error", 409, `{"code": "not_your_turn", "message": "Not your turn", "status": 409}`,
+			Error{Code: api.ErrNotYourTurn, Message: "Not your turn", Status: 409}},
+		{"plain text", 404, "404 page not found\n",
+			Error{Code: api.ErrNotFound, Message: "404 page not found", Status: 404}},
+		{"JSON without a code", 400, `{"message": "Bad"}`,
+			Error{Code: api.ErrBadRequest, Message: `{"message": "Bad"}`, Status: 400}},
+		{"unknown status", 502, "<html>Bad gateway</html>",
+			Error{Code: api.ErrInternal, Message: "<html>Bad gateway</html>", Status: 502}},
+	}
+
+	for _, test := range tests {
+		server, client := start_server(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		})
+
+		_, err := client.State()
+		server.Close()
+
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: got %v, want an Error", test.name, err)
+			continue
+		}
+		if e.Code != test.want.Code || e.Message != test.want.Message || e.Status != test.want.Status {
+			t.Errorf("%s: got %+v, want %+v", test.name, *e, test.want)
+		}
+		if !HasCode(err, test.want.Code) {
+			t.Errorf("%s: HasCode(%s) is false", test.name, test.want.Code)
+		}
+	}
+}
+
+func TestWaitForTurn(t *testing.T) {
+	polls := 0
+	server, client := start_server(t, func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		state := api.GameState{Phase: api.PhasePicking, Seat: 0, Leader: 1}
+		if polls == 3 {
+			state.Leader = 0
+		}
+		json.NewEncoder(w).Encode(&state)
+	})
+	defer server.Close()
+
+	state, err := client.WaitForTurn(time.Millisecond, 0)
+	if err != nil {
+		t.Fatal("Error waiting for our turn: ", err)
+	}
+	if polls != 3 || !MyTurn(state) {
+		t.Errorf("Returned after %d polls with %+v, want our turn after 3", polls, state)
+	}
+}
+
+func TestWaitForTurnTimeout(t *testing.T) {
+	server, client := start_server(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&api.GameState{Phase: api.PhasePicking, Seat: 0, Leader: 1})
+	})
+	defer server.Close()
+
+	start := time.Now()
+	state, err := client.WaitForTurn(10 * time.Millisecond, 50 * time.Millisecond)
+	if err != ErrTimeout {
+		t.Fatalf("Got %v, want ErrTimeout", err)
+	}
+	if state.Phase != api.PhasePicking {
+		t.Errorf("Got %+v, want the last state seen", state)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Took %s to time out after 50ms", elapsed)
+	}
+}
+
+// The series endpoints answer with the new game's state, which is
+// returned without asking for it again
+func TestStartSeries(t *testing.T) {
+	paths := []string{}
+	server, client := start_server(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		json.NewEncoder(w).Encode(&api.GameState{Game: "game", Phase: api.PhasePicking})
+	})
+	defer server.Close()
+
+	state, err := client.StartSeries(api.SeriesStartRequest{Cards: []string{"Merlin"}})
+	if err != nil {
+		t.Fatal("Error starting series: ", err)
+	}
+	if state.Game != "game" {
+		t.Errorf("Got %+v, want the state from /series/start", state)
+	}
+	if len(paths) != 1 || paths[0] != api.Prefix + "/series/start" {
+		t.Errorf("Requested %v, want only %s/series/start", paths, api.Prefix)
+	}
+}
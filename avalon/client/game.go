@@ -0,0 +1,116 @@
+package client
+
+import (
+	"avalon/api"
+	"errors"
+	"time"
+)
+
+func (client *Client) game_request(path string, request interface{}) (api.GameState, error) {
+	var state api.GameState
+	err := client.post(api.Prefix + path, request, &state)
+	return state, err
+}
+
+// This joins the game being played in our room
+func (client *Client) Join() (api.GameState, error) {
+	return client.game_request("/game/join", nil)
+}
+
+// This starts a game from the lobby, as the room's host, once everybody
+// is ready
+func (client *Client) StartGame() (api.GameState, error) {
+	return client.game_request("/room/start", nil)
+}
+
+func (client *Client) State() (api.GameState, error) {
+	return client.game_request("/game/state", nil)
+}
+
+func (client *Client) Reveal() (api.Reveals, error) {
+	var reveals api.Reveals
+	err := client.post(api.Prefix + "/game/reveal", nil, &reveals)
+	return reveals, err
+}
+
+// The moves are for the current mission and proposal in state
+
+func (client *Client) Propose(state api.GameState, players []int) (api.GameState, error) {
+	return client.game_request("/game/propose", api.ProposeRequest{Mission: state.Mission, Proposal: state.Proposal, Players: players})
+}
+
+func (client *Client) Vote(state api.GameState, approve bool) (api.GameState, error) {
+	vote := "reject"
+	if approve {
+		vote = "approve"
+	}
+	return client.game_request("/game/vote", api.VoteRequest{Mission: state.Mission, Proposal: state.Proposal, Vote: vote})
+}
+
+// The action is one of state.MissionState.Actions
+func (client *Client) Act(state api.GameState, action string) (api.GameState, error) {
+	return client.game_request("/game/mission", api.MissionRequest{Mission: state.Mission, Proposal: state.Proposal, Action: action})
+}
+
+func (client *Client) Assassinate(target int) (api.GameState, error) {
+	return client.game_request("/game/assassin", api.AssassinRequest{Target: target})
+}
+
+func (client *Client) Decide(decision api.Decision, choice int) (api.GameState, error) {
+	return client.game_request("/game/decide", api.DecideRequest{Decision: decision.Id, Choice: choice})
+}
+
+func (client *Client) Poke() (api.GameState, error) {
+	return client.game_request("/game/poke", nil)
+}
+
+// This is true if the game is waiting on a move from us, or we have a
+// decision to make
+func MyTurn(state api.GameState) bool {
+	if len(state.Decisions) > 0 {
+		return true
+	}
+
+	switch state.Phase {
+	case api.PhasePicking:
+		return state.Leader == state.Seat
+	case api.PhaseVoting:
+		return !state.Voting.Voted[state.Seat]
+	case api.PhaseMission:
+		for i, seat := range state.MissionState.Players {
+			if seat == state.Seat {
+				return !state.MissionState.Acted[i]
+			}
+		}
+	case api.PhaseAssassination:
+		return state.Assassination.Assassin == state.Seat
+	}
+	return false
+}
+
+var ErrTimeout = errors.New("Timed out waiting for our turn")
+
+// This polls the game state every interval until it is our turn or the
+// game is over, and returns that state. After timeout it gives up with
+// ErrTimeout and the last state it saw; a timeout of 0 waits forever.
+func (client *Client) WaitForTurn(interval time.Duration, timeout time.Duration) (api.GameState, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	for {
+		state, err := client.State()
+		if err != nil {
+			return state, err
+		}
+		if state.Phase == api.PhaseGameOver || MyTurn(state) {
+			return state, nil
+		}
+
+		if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+			return state, ErrTimeout
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"avalon/api"
+	"testing"
+)
+
+func TestMyTurn(t *testing.T) {
+	tests := []struct {
+		name string
+		state api.GameState
+		want bool
+	}{
+		{"picking as leader", api.GameState{Phase: api.PhasePicking, Seat: 1, Leader: 1}, true},
+		{"picking as another seat", api.GameState{Phase: api.PhasePicking, Seat: 2, Leader: 1}, false},
+		{"voting before our vote", api.GameState{Phase: api.PhaseVoting, Seat: 1,
+			Voting: &api.VotingState{Players: []int{0, 2}, Voted: []bool{true, false, true}}}, true},
+		{"voting after our vote", api.GameState{Phase: api.PhaseVoting, Seat: 1,
+			Voting: &api.VotingState{Players: []int{0, 2}, Voted: []bool{false, true, false}}}, false},
+		{"mission we are on", api.GameState{Phase: api.PhaseMission, Seat: 2,
+			MissionState: &api.MissionState{Players: []int{0, 2}, Acted: []bool{true, false}}}, true},
+		{"mission we have acted on", api.GameState{Phase: api.PhaseMission, Seat: 2,
+			MissionState: &api.MissionState{Players: []int{0, 2}, Acted: []bool{false, true}}}, false},
+		{"mission we are not on", api.GameState{Phase: api.PhaseMission, Seat: 1,
+			MissionState: &api.MissionState{Players: []int{0, 2}, Acted: []bool{false, false}}}, false},
+		{"assassination as the assassin", api.GameState{Phase: api.PhaseAssassination, Seat: 3,
+			Assassination: &api.AssassinationState{Assassin: 3}}, true},
+		{"assassination as another seat", api.GameState{Phase: api.PhaseAssassination, Seat: 0,
+			Assassination: &api.AssassinationState{Assassin: 3}}, false},
+		{"game over", api.GameState{Phase: api.PhaseGameOver, GameOver: &api.GameOverState{}}, false},
+		{"pending decision", api.GameState{Phase: api.PhasePicking, Seat: 2, Leader: 1,
+			Decisions: []api.Decision{{Id: 1, Players: []int{0}}}}, true},
+	}
+
+	for _, test := range tests {
+		if got := MyTurn(test.state); got != test.want {
+			t.Errorf("%s: MyTurn = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
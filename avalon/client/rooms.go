@@ -0,0 +1,38 @@
+package client
+
+import (
+	"avalon/api"
+)
+
+func (client *Client) room_request(path string, request interface{}) (api.Room, error) {
+	var room api.Room
+	err := client.post(api.Prefix + path, request, &room)
+	return room, err
+}
+
+// This makes a new room, with us as its host
+func (client *Client) CreateRoom(name string) (api.Room, error) {
+	return client.room_request("/room/create", api.CreateRoomRequest{Name: name})
+}
+
+// This joins the room with the code given, under the name given
+func (client *Client) JoinRoom(code string, name string) (api.Room, error) {
+	return client.room_request("/room/join", api.JoinRoomRequest{Code: code, Name: name})
+}
+
+func (client *Client) Lobby() (api.Room, error) {
+	return client.room_request("/room/lobby", nil)
+}
+
+func (client *Client) SetReady(ready bool) (api.Room, error) {
+	return client.room_request("/room/ready", api.ReadyRequest{Ready: ready})
+}
+
+// This changes the settings for the next game, as the host
+func (client *Client) ChangeSettings(settings api.RoomSettings) (api.Room, error) {
+	return client.room_request("/room/settings", settings)
+}
+
+func (client *Client) LeaveRoom() error {
+	return client.post(api.Prefix + "/room/leave", nil, nil)
+}
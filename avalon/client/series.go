@@ -0,0 +1,34 @@
+package client
+
+import (
+	"avalon/api"
+)
+
+// This answers a rematch of our finished game, and returns how it is
+// going. Call it again with a nil accept to check on it without
+// answering; once it has started, we move to the new game if we
+// accepted.
+func (client *Client) Rematch(accept *bool) (api.Rematch, error) {
+	var rematch api.Rematch
+	err := client.post(api.Prefix + "/game/rematch", api.RematchRequest{Accept: accept}, &rematch)
+	return rematch, err
+}
+
+// This starts a series in our room, outside a lobby, with its first
+// game. Series from a lobby are started by StartGame with the room's
+// Series setting.
+func (client *Client) StartSeries(request api.SeriesStartRequest) (api.GameState, error) {
+	return client.game_request("/series/start", request)
+}
+
+// This starts the next game of our room's series, or joins it if
+// somebody else already has
+func (client *Client) NextSeriesGame() (api.GameState, error) {
+	return client.game_request("/series/next", nil)
+}
+
+func (client *Client) SeriesSummary() (api.SeriesSummary, error) {
+	var summary api.SeriesSummary
+	err := client.post(api.Prefix + "/series/summary", nil, &summary)
+	return summary, err
+}
@@ -0,0 +1,105 @@
+// +build !appengine
+
+// avalon-import loads a game saved from /admin/export into a running
+// server (usually a local dev server) under a new game ID.
+//
+//	avalon-import -list game.json
+//	avalon-import -server http://localhost:8080 -truncate 12 game.json
+//
+// -list prints the game's events without touching the server; pass
+// an event's index to -truncate to load the game as it stood straight
+// after that event. /admin is admin-only, so -cookie takes the login
+// cookie to send (on the dev server, dev_appserver_login=...).
+package main
+
+import (
+	"avalon/data"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "server to import into")
+	room := flag.String("room", "", "room to put the game in (defaults to the one it came from)")
+	truncate := flag.Int("truncate", -1, "index of the last event to import (-1 imports everything)")
+	list := flag.Bool("list", false, "list the game's events and exit")
+	cookie := flag.String("cookie", "", "cookie to send, to log in as an admin")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: avalon-import [flags] game.json")
+		os.Exit(2)
+	}
+
+	body, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "avalon-import:", err)
+		os.Exit(2)
+	}
+
+	var export data.GameExport
+	err = json.Unmarshal(body, &export)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "avalon-import: parsing export:", err)
+		os.Exit(2)
+	}
+
+	if *list {
+		fmt.Printf("Game %s in room %s, cards %v\n", export.Game.Id, export.Game.Room, export.Game.Setup.Cards)
+		for _, event := range export.Events() {
+			fmt.Printf("%3d  %s\n", event.Index, event.Description)
+		}
+		return
+	}
+
+	params := url.Values{}
+	if *room != "" {
+		params.Set("room", *room)
+	}
+	if *truncate >= 0 {
+		params.Set("truncate", strconv.Itoa(*truncate))
+	}
+
+	req, err := http.NewRequest("POST", *server + "/admin/import?" + params.Encode(), bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "avalon-import:", err)
+		os.Exit(2)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *cookie != "" {
+		req.Header.Set("Cookie", *cookie)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "avalon-import:", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "avalon-import: server said %s: %s", resp.Status, message)
+		os.Exit(1)
+	}
+
+	var result struct {
+		Room string `json:"room"`
+		Game string `json:"game"`
+		Events []data.ExportEvent `json:"events"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "avalon-import: parsing response:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Imported %d events as game %s in room %s\n", len(result.Events), result.Game, result.Room)
+}
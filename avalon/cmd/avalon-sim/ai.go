@@ -0,0 +1,232 @@
+// +build !appengine
+
+package main
+
+import (
+	"avalon/data"
+	"avalon/data/cards"
+	"sort"
+	"strings"
+)
+
+// simPlayer is a simple heuristic player. It only uses what its seat
+// would be shown in a real game: its own card, its reveals, and the
+// public vote and mission results.
+type simPlayer struct {
+	sim *simGame
+	Pos int
+	Card data.CardOps
+	Evil bool
+
+	// Evil players: the other spies this seat has been shown
+	Allies map[int]bool
+	// Good players: the spies this seat has been shown (Merlin)
+	KnownEvil map[int]bool
+	// Everything this seat has been shown, at reveal time and by
+	// phase hooks
+	Reveals []data.GameReveal
+
+	// How likely we think each player is to be evil, from mission results
+	Suspicion []float64
+	// How often each player has rejected a team with a known spy on
+	// it - the assassin uses this to find Merlin
+	Rejections []int
+}
+
+func newSimPlayer(sim *simGame, pos int) *simPlayer {
+	card := sim.card(pos)
+	p := &simPlayer{
+		sim: sim,
+		Pos: pos,
+		Card: card,
+		Evil: card.AllocatedAsSpy(),
+		Allies: map[int]bool{},
+		KnownEvil: map[int]bool{},
+		Suspicion: make([]float64, len(sim.Roles)),
+		Rejections: make([]int, len(sim.Roles)),
+	}
+
+	// A little noise, so that players without information still have
+	// a consistent opinion of each other
+	for pos := range p.Suspicion {
+		p.Suspicion[pos] = sim.Rand.Float64() / 100
+	}
+
+	for _, reveal := range card.Reveal(sim.Game) {
+		p.SawReveal(reveal)
+	}
+
+	return p
+}
+
+func (p *simPlayer) SawReveal(reveal data.GameReveal) {
+	p.Reveals = append(p.Reveals, reveal)
+	for _, other := range reveal.Players {
+		if other == p.Pos {
+			continue
+		}
+		if p.Evil {
+			p.Allies[other] = true
+		} else if strings.HasPrefix(reveal.Label, cards.EvilRevealLabel) {
+			p.KnownEvil[other] = true
+		}
+	}
+}
+
+func (p *simPlayer) isSpy(pos int) bool {
+	return (pos == p.Pos && p.Evil) || p.Allies[pos]
+}
+
+// This returns everybody but us, least suspicious first
+func (p *simPlayer) ranked() []int {
+	others := []int{}
+	for pos := range p.sim.Roles {
+		if pos != p.Pos {
+			others = append(others, pos)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return p.Suspicion[others[i]] < p.Suspicion[others[j]]
+	})
+	return others
+}
+
+func (p *simPlayer) Propose() []int {
+	size := p.sim.Setup.Missions[p.sim.State.ThisMission].Size
+	team := []int{p.Pos}
+	for _, pos := range p.ranked() {
+		if len(team) >= size {
+			break
+		}
+		// Good players leave out the spies they know about; spies
+		// keep their friends off the team so as not to double up
+		if p.KnownEvil[pos] || p.Allies[pos] {
+			continue
+		}
+		team = append(team, pos)
+	}
+	// If we ran out of acceptable players, fill up with whoever is left
+	for _, pos := range p.ranked() {
+		if len(team) >= size {
+			break
+		}
+		if _, ok := (data.Proposal{Players: team}).LookupMissionSlot(pos); !ok {
+			team = append(team, pos)
+		}
+	}
+	return team
+}
+
+func (p *simPlayer) Vote(proposal data.Proposal) bool {
+	_, onTeam := proposal.LookupMissionSlot(p.Pos)
+
+	if p.Evil {
+		if onTeam {
+			return true
+		}
+		for _, pos := range proposal.Players {
+			if p.Allies[pos] {
+				return true
+			}
+		}
+		// Approve some clean teams anyway, so as not to stand out
+		return p.sim.Rand.Intn(2) == 0
+	}
+
+	// Players who have been shown the spies (Merlin) only act on it
+	// some of the time, so as not to give themselves away to the
+	// assassin
+	if p.sim.Rand.Intn(2) == 0 {
+		for _, pos := range proposal.Players {
+			if p.KnownEvil[pos] {
+				return false
+			}
+		}
+	}
+
+	// Reject teams carrying any of the players we have real evidence
+	// against, up to the number of spies in the game
+	ranked := p.ranked()
+	suspects := map[int]bool{}
+	for i := len(ranked) - 1; i >= 0 && len(suspects) < p.sim.Setup.Spies; i-- {
+		if p.Suspicion[ranked[i]] >= 0.1 {
+			suspects[ranked[i]] = true
+		}
+	}
+	for _, pos := range proposal.Players {
+		if suspects[pos] {
+			return false
+		}
+	}
+	return true
+}
+
+// This returns true for success and false for failure
+func (p *simPlayer) Act(proposal data.Proposal) bool {
+	if !p.Card.PermittedActions(p.sim.Game, proposal)["Failure"] {
+		return true
+	}
+
+	// Let the first mission through now and then, to build some trust
+	if p.sim.State.ThisMission == 0 && p.sim.Rand.Intn(2) == 0 {
+		return true
+	}
+
+	// Leave the failing to the first spy we know of on the team
+	for _, pos := range proposal.Players {
+		if p.Allies[pos] && pos < p.Pos {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *simPlayer) SawVote(vote data.VoteResult) {
+	spyOnTeam := false
+	for _, pos := range vote.Players {
+		if p.isSpy(pos) {
+			spyOnTeam = true
+		}
+	}
+	if !spyOnTeam {
+		return
+	}
+	for pos, approve := range vote.Votes {
+		if !approve {
+			p.Rejections[pos]++
+		}
+	}
+}
+
+func (p *simPlayer) SawMission(result data.MissionResult) {
+	// A clean mission is decent evidence that everyone on it is good,
+	// though spies do sometimes let one through
+	share := -0.5
+	if result.Fails > 0 {
+		share = float64(result.Fails) / float64(len(result.Players))
+	}
+	for _, pos := range result.Players {
+		if pos != p.Pos {
+			p.Suspicion[pos] += share
+		}
+	}
+}
+
+// Decisions are made at random, since no card asking for one yet is
+// worth teaching the AI about
+func (p *simPlayer) Decide(decision data.Decision) int {
+	return decision.Players[p.sim.Rand.Intn(len(decision.Players))]
+}
+
+func (p *simPlayer) Assassinate() int {
+	target := -1
+	for _, pos := range p.sim.Rand.Perm(len(p.sim.Roles)) {
+		if p.isSpy(pos) {
+			continue
+		}
+		if target == -1 || p.Rejections[pos] > p.Rejections[target] {
+			target = pos
+		}
+	}
+	return target
+}
@@ -0,0 +1,161 @@
+// +build !appengine
+
+// avalon-sim plays AI-only games in memory, to judge how balanced a
+// card set is before using it for real.
+//
+//	avalon-sim -players 7 -cards Merlin,Mordred,Oberon -games 10000
+//
+// The cards given are the special ones; the remaining slots are filled
+// with Good and Evil, and an Assassin is added if Merlin needs one.
+// Run it from the app directory, or point -cardfile at cards.json.
+package main
+
+import (
+	"avalon/data/cards"
+	_ "avalon/data/cards/cleric"
+	"flag"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	players := flag.Int("players", 5, "number of players")
+	cardList := flag.String("cards", "Merlin", "comma-separated special cards to play with")
+	games := flag.Int("games", 10000, "number of games to simulate")
+	seed := flag.Int64("seed", 0, "random seed (0 picks one from the clock)")
+	cardFile := flag.String("cardfile", "cards.json", "card definitions file")
+	flag.Parse()
+
+	err := cards.LoadCardDefinitions(*cardFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "avalon-sim: loading card definitions:", err)
+		os.Exit(2)
+	}
+
+	special := []string{}
+	for _, label := range strings.Split(*cardList, ",") {
+		label = strings.TrimSpace(label)
+		if label != "" {
+			special = append(special, label)
+		}
+	}
+
+	labels, err := cards.FillCardSet(*players, special)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "avalon-sim:", err)
+		os.Exit(2)
+	}
+
+	// The same checks as starting a real game
+	problems, warnings := cards.CheckCardSet(labels)
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "avalon-sim: warning:", warning)
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, "avalon-sim:", problem)
+		}
+		os.Exit(2)
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UTC().UnixNano()
+	}
+	r := mathrand.New(mathrand.NewSource(*seed))
+
+	stats := newSimStats()
+	for i := 0; i < *games; i++ {
+		stats.Add(newSimGame(r, labels).Play())
+	}
+
+	fmt.Printf("%d games, %d players, cards %s, seed %d\n\n", *games, *players, strings.Join(labels, ","), *seed)
+	stats.Print(os.Stdout)
+}
+
+type tally struct {
+	Games int
+	Wins int
+}
+
+func (t *tally) Add(won bool) {
+	t.Games++
+	if won {
+		t.Wins++
+	}
+}
+
+func (t tally) Rate() float64 {
+	if t.Games == 0 {
+		return 0
+	}
+	return 100 * float64(t.Wins) / float64(t.Games)
+}
+
+type simStats struct {
+	Games int
+	Teams map[string]*tally
+	Roles map[string]*tally
+	Ends map[string]int
+}
+
+func newSimStats() *simStats {
+	return &simStats{
+		Teams: map[string]*tally{"Good": &tally{}, "Evil": &tally{}},
+		Roles: map[string]*tally{},
+		Ends: map[string]int{},
+	}
+}
+
+func (stats *simStats) Add(result SimResult) {
+	stats.Games++
+	stats.Ends[result.End]++
+
+	goodWon := cards.GoodHasWon(result.Game)
+	stats.Teams["Good"].Add(goodWon)
+	stats.Teams["Evil"].Add(!goodWon)
+
+	for pos, role := range result.Game.Roles {
+		label := result.Game.Cards[role].Label()
+		if stats.Roles[label] == nil {
+			stats.Roles[label] = &tally{}
+		}
+		stats.Roles[label].Add(result.Winners[pos])
+	}
+}
+
+func (stats *simStats) Print(f io.Writer) {
+	w := tabwriter.NewWriter(f, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "Team\tWins\tRate")
+	for _, team := range []string{"Good", "Evil"} {
+		t := stats.Teams[team]
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\n", team, t.Wins, t.Rate())
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Role\tSeats\tWins\tRate")
+	labels := []string{}
+	for label := range stats.Roles {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		t := stats.Roles[label]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\n", label, t.Games, t.Wins, t.Rate())
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Ending\tGames\tRate")
+	for _, end := range []string{EndGoodMissions, EndEvilMissions, EndAssassinated} {
+		n := stats.Ends[end]
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\n", end, n, 100*float64(n)/float64(stats.Games))
+	}
+
+	w.Flush()
+}
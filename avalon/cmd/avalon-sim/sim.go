@@ -0,0 +1,226 @@
+// +build !appengine
+
+package main
+
+import (
+	"avalon/data"
+	"avalon/data/cards"
+	mathrand "math/rand"
+)
+
+// These are the ways a simulated game can end
+const (
+	EndGoodMissions = "good: three successful missions"
+	EndEvilMissions = "evil: three failed missions"
+	EndAssassinated = "evil: Merlin assassinated"
+)
+
+type SimResult struct {
+	Game data.Game
+	End string
+	// This is true for each seat whose card has won
+	Winners []bool
+}
+
+type simGame struct {
+	data.Game
+	Rand *mathrand.Rand
+	Players []*simPlayer
+	Votes []data.VoteResult
+	Missions []data.MissionResult
+}
+
+func newSimGame(r *mathrand.Rand, labels []string) *simGame {
+	setup := data.GetSizeSetup(len(labels))
+	setup.Cards = labels
+
+	game := data.Game{
+		GameStatic: data.GameStatic{
+			Id: "sim",
+			Setup: setup,
+			Roles: r.Perm(len(labels)),
+		},
+		State: &data.GameState{
+			DataVersion: 1,
+			Leader: 0,
+			MissionsComplete: make([]bool, len(setup.Missions)),
+			AssassinTarget: -1,
+		},
+		Cards: make([]data.CardOps, len(labels)),
+	}
+	for i, label := range labels {
+		game.Cards[i] = cards.CardFactory[label]()
+	}
+
+	sim := &simGame{Game: game, Rand: r}
+	sim.Players = make([]*simPlayer, len(labels))
+	for pos := range sim.Players {
+		sim.Players[pos] = newSimPlayer(sim, pos)
+	}
+	return sim
+}
+
+func (sim *simGame) card(pos int) data.CardOps {
+	return sim.Cards[sim.Roles[pos]]
+}
+
+func (sim *simGame) nextLeader() {
+	sim.State.Leader++
+	if sim.State.Leader >= len(sim.Roles) {
+		sim.State.Leader = 0
+	}
+}
+
+// This follows the same sequence of phases as the gameplay package,
+// without any of the storage
+func (sim *simGame) Play() SimResult {
+	for !sim.State.GameOver {
+		sim.phaseResults(sim.BeforePicking())
+		players := sim.Players[sim.State.Leader].Propose()
+		proposal := data.Proposal{
+			Leader: sim.State.Leader,
+			Players: players,
+			Votes: make([]bool, len(sim.Roles)),
+			Voted: make([]bool, len(sim.Roles)),
+		}
+
+		if sim.State.ThisProposal == 4 {
+			// We represent the 5th proposal as having been unanimously approved
+			for i := range proposal.Votes {
+				proposal.Votes[i] = true
+				proposal.Voted[i] = true
+			}
+		} else {
+			for i, p := range sim.Players {
+				proposal.Votes[i] = p.Vote(proposal)
+				proposal.Voted[i] = true
+			}
+			sim.recordVote(proposal)
+		}
+
+		approves, rejects := countBools(proposal.Votes)
+		if approves <= rejects {
+			sim.State.ThisProposal++
+			sim.nextLeader()
+			continue
+		}
+
+		sim.runMission(proposal)
+	}
+
+	return sim.result()
+}
+
+func (sim *simGame) recordVote(proposal data.Proposal) {
+	vote := data.VoteResult{
+		Index: sim.State.ThisVote,
+		Mission: sim.State.ThisMission,
+		Proposal: sim.State.ThisProposal,
+		Leader: proposal.Leader,
+		Players: proposal.Players,
+		Votes: proposal.Votes,
+	}
+	sim.Votes = append(sim.Votes, vote)
+	sim.phaseResults(sim.AfterVote(vote))
+	sim.State.ThisVote++
+	for _, p := range sim.Players {
+		p.SawVote(vote)
+	}
+}
+
+func (sim *simGame) runMission(proposal data.Proposal) {
+	fails := 0
+	for _, pos := range proposal.Players {
+		if !sim.Players[pos].Act(proposal) {
+			fails++
+		}
+	}
+
+	result := data.MissionResult{
+		Mission: sim.State.ThisMission,
+		Proposal: sim.State.ThisProposal,
+		Leader: sim.State.Leader,
+		Players: proposal.Players,
+		Fails: fails,
+		FailsAllowed: sim.Setup.Missions[sim.State.ThisMission].FailsAllowed,
+	}
+	sim.Missions = append(sim.Missions, result)
+	sim.State.MissionsComplete[result.Mission] = true
+	sim.phaseResults(sim.AfterMission(result))
+	if result.Fails > result.FailsAllowed {
+		sim.State.EvilScore++
+	} else {
+		sim.State.GoodScore++
+	}
+	for _, p := range sim.Players {
+		p.SawMission(result)
+	}
+
+	if sim.State.GoodScore >= 3 || sim.State.EvilScore >= 3 {
+		assassin := sim.FindAssassin()
+		if assassin != -1 && sim.State.EvilScore < 3 {
+			sim.State.AssassinTarget = sim.Players[assassin].Assassinate()
+		}
+		sim.phaseResults(sim.BeforeGameOver())
+		sim.State.GameOver = true
+		return
+	}
+
+	sim.nextLeader()
+	sim.State.ThisProposal = 0
+	sim.State.ThisMission++
+}
+
+// This shows each seat what the phase hooks produced for it. The
+// seat's decisions are made straight away, which the gameplay package
+// leaves until the player gets round to them.
+func (sim *simGame) phaseResults(results []data.PhaseResult) {
+	for seat, result := range results {
+		sim.phaseResult(seat, result)
+	}
+}
+
+func (sim *simGame) phaseResult(seat int, result data.PhaseResult) {
+	for _, reveal := range result.Reveals {
+		sim.Players[seat].SawReveal(reveal)
+	}
+
+	hook, ok := sim.card(seat).(data.DecisionHook)
+	for _, decision := range result.Decisions {
+		decision.Seat = seat
+		decision.Choice = sim.Players[seat].Decide(decision)
+		decision.Resolved = true
+		if ok {
+			sim.phaseResult(seat, hook.Decide(sim.Game, seat, decision, decision.Choice))
+		}
+	}
+}
+
+func (sim *simGame) result() SimResult {
+	result := SimResult{Game: sim.Game, Winners: make([]bool, len(sim.Roles))}
+	for pos := range sim.Roles {
+		result.Winners[pos] = sim.card(pos).HasWon(sim.Game)
+	}
+
+	if sim.State.EvilScore >= 3 {
+		result.End = EndEvilMissions
+	} else if cards.GoodHasWon(sim.Game) {
+		result.End = EndGoodMissions
+	} else {
+		result.End = EndAssassinated
+	}
+	return result
+}
+
+func countBools(values []bool) (int, int) {
+	trues := 0
+	falses := 0
+	for _, val := range values {
+		if val {
+			trues++
+		} else {
+			falses++
+		}
+	}
+	return trues, falses
+}
@@ -0,0 +1,45 @@
+// +build !appengine
+
+package main
+
+import (
+	mathrand "math/rand"
+	"testing"
+)
+
+// The Cleric's reveal comes from a phase hook, so this checks that
+// a game played through the hooks shows it to the Cleric, and only
+// once
+func TestClericSeesFirstLeader(t *testing.T) {
+	r := mathrand.New(mathrand.NewSource(1))
+	labels := []string{"Cleric", "Good", "Good", "Evil", "Evil"}
+
+	for i := 0; i < 100; i++ {
+		sim := newSimGame(r, labels)
+		sim.Play()
+
+		for pos, p := range sim.Players {
+			// Everyone else only sees what their card shows them at
+			// reveal time
+			want := len(p.Card.Reveal(sim.Game))
+			if p.Card.Label() == "Cleric" && pos != 0 {
+				want = 1
+			}
+			if len(p.Reveals) != want {
+				t.Fatalf("Seat %d (%s) saw %d reveals, want %d", pos, p.Card.Label(), len(p.Reveals), want)
+			}
+			if p.Card.Label() != "Cleric" || want == 0 {
+				continue
+			}
+
+			reveal := p.Reveals[0]
+			label := "The first leader is good"
+			if sim.card(0).AllocatedAsSpy() {
+				label = "The first leader is evil"
+			}
+			if reveal.Label != label || len(reveal.Players) != 1 || reveal.Players[0] != 0 {
+				t.Errorf("Cleric in seat %d saw %+v, want %q about seat 0", pos, reveal, label)
+			}
+		}
+	}
+}
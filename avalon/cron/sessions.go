@@ -0,0 +1,45 @@
+// Package cron has the handlers that cron.yaml runs
+package cron
+
+import (
+	"appengine"
+	"avalon/db"
+	"avalon/web"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"time"
+)
+
+func init() {
+	http.Handle("/admin/cron/sessions", web.AppHandler(ReqDeleteSessions))
+}
+
+// Sessions are deleted in batches, stopping well inside the request
+// deadline. Any left over go on the next run.
+const (
+	sessionBatchSize = 500
+	sessionTimeLimit = 30 * time.Second
+)
+
+// This deletes server-side sessions that have expired. Expired
+// sessions are never used, but are only deleted when somebody comes
+// back with one, which most never do.
+func ReqDeleteSessions(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	start := time.Now()
+	deleted := 0
+	for time.Since(start) < sessionTimeLimit {
+		count, err := db.DeleteExpiredSessions(c, sessionBatchSize)
+		if err != nil {
+			return &web.AppError{err, "Error deleting sessions", 500}
+		}
+		deleted += count
+		if count < sessionBatchSize {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "Deleted %d expired sessions\n", deleted)
+	return nil
+}
@@ -3,6 +3,7 @@ package cards
 import (
 	"avalon/data"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -13,6 +14,14 @@ func (card goodCard) Label() string {
 	return "Good"
 }
 
+func (card goodCard) Description() string {
+	return "A loyal servant of Arthur, with no special knowledge."
+}
+
+func (card goodCard) Notes() []string {
+	return nil
+}
+
 func (card goodCard) AllocatedAsSpy() bool {
 	return false
 }
@@ -52,6 +61,14 @@ func (card evilCard) Label() string {
 	return "Evil"
 }
 
+func (card evilCard) Description() string {
+	return "A minion of Mordred, who knows the other evil players."
+}
+
+func (card evilCard) Notes() []string {
+	return nil
+}
+
 func (card evilCard) AllocatedAsSpy() bool {
 	return true
 }
@@ -92,6 +109,10 @@ func GoodHasWon(game data.Game) bool {
 	return game.State.GoodScore >= 3
 }
 
+// This is the label prefix used by RevealEvil, so consumers can tell
+// "these players are evil" reveals apart from other kinds
+const EvilRevealLabel = "These are the evil players"
+
 func RevealEvil(game data.Game, to data.CardOps) data.GameReveal {
 	players := make([]int, 0)
 	hiddenEvil := make([]data.CardOps, 0)
@@ -106,12 +127,14 @@ func RevealEvil(game data.Game, to data.CardOps) data.GameReveal {
 		}
 	}
 
-	label := "These are the evil players"
+	label := EvilRevealLabel
 	if len(hiddenEvil) > 0 {
 		hiddenLabels := make([]string, len(hiddenEvil))
 		for i, c := range hiddenEvil {
 			hiddenLabels[i] = c.Label()
 		}
+		// Sorted, so the order doesn't give away where they are sitting
+		sort.Strings(hiddenLabels)
 		label = label + " (excluding " + strings.Join(hiddenLabels, ", ") + ")"
 	}
 
@@ -0,0 +1,76 @@
+package cleric
+
+import (
+	"avalon/data"
+	"avalon/data/cards"
+)
+
+type clericCard struct {
+}
+
+func (card clericCard) Label() string {
+	return "Cleric"
+}
+
+func (card clericCard) Description() string {
+	return "A loyal servant who learns whether the first leader is good or evil."
+}
+
+func (card clericCard) Notes() []string {
+	return []string{
+		"The Cleric is told before the first team is picked. If the Cleric is the first leader, they learn nothing.",
+	}
+}
+
+func (card clericCard) AllocatedAsSpy() bool {
+	return false
+}
+
+func (card clericCard) Maximum() int {
+	return 1
+}
+
+func (card clericCard) AssassinPriority() int {
+	return 0
+}
+
+func (card clericCard) HasWon(game data.Game) bool {
+	return cards.GoodHasWon(game)
+}
+
+func (card clericCard) PermittedActions(game data.Game, proposal data.Proposal) map[string]bool {
+	return map[string]bool {
+		"Success": true,
+		"Failure": false,
+	}
+}
+
+func (card clericCard) Reveal(game data.Game) []data.GameReveal {
+	return []data.GameReveal{}
+}
+
+func (card clericCard) HiddenFrom(game data.Game, other data.CardOps) bool {
+	return false
+}
+
+// The first leader is the leader of the first proposal of the first
+// mission; picking starts over for every proposal, so the later ones
+// are skipped
+func (card clericCard) BeforePicking(game data.Game, seat int) data.PhaseResult {
+	leader := game.State.Leader
+	if game.State.ThisMission != 0 || game.State.ThisProposal != 0 || leader == seat {
+		return data.PhaseResult{}
+	}
+
+	label := "The first leader is good"
+	if game.Cards[game.Roles[leader]].AllocatedAsSpy() {
+		label = "The first leader is evil"
+	}
+	return data.PhaseResult{
+		Reveals: []data.GameReveal{ data.GameReveal{ Label: label, Players: []int{ leader } } },
+	}
+}
+
+func init() {
+	cards.AddCardType(clericCard{})
+}
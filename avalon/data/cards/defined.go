@@ -0,0 +1,189 @@
+package cards
+
+import (
+	"avalon/data"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+// CardDefinition describes a card with no special mechanics, as
+// loaded from the card definitions file. Cards which need more than
+// this can still be written in go and registered with AddCardType.
+type CardDefinition struct {
+	Label string `json:"label"`
+	// Either "good" or "evil"
+	Team string `json:"team"`
+	Description string `json:"description"`
+	Notes []string `json:"notes"`
+	Maximum int `json:"maximum"`
+	AssassinPriority int `json:"assassin_priority"`
+	// The mission actions this card may take - if this is empty, good
+	// cards may only succeed and evil cards may succeed or fail
+	Actions []string `json:"actions"`
+	// What this card is shown at reveal time: "evil" shows the evil
+	// players (less any hidden from this card), and any other entry
+	// is the label of a card to point out
+	Sees []string `json:"sees"`
+	// Labels of the cards this card is not revealed to, or "*" to be
+	// hidden from everybody
+	HiddenFrom []string `json:"hidden_from"`
+	// See data.CardConstraints
+	Requires []string `json:"requires"`
+	Wants []string `json:"wants"`
+	Excludes []string `json:"excludes"`
+}
+
+type definedCard struct {
+	def *CardDefinition
+}
+
+func (card definedCard) Label() string {
+	return card.def.Label
+}
+
+func (card definedCard) Description() string {
+	return card.def.Description
+}
+
+func (card definedCard) Notes() []string {
+	return card.def.Notes
+}
+
+func (card definedCard) AllocatedAsSpy() bool {
+	return card.def.Team == "evil"
+}
+
+func (card definedCard) Maximum() int {
+	return card.def.Maximum
+}
+
+func (card definedCard) AssassinPriority() int {
+	return card.def.AssassinPriority
+}
+
+func (card definedCard) HasWon(game data.Game) bool {
+	if card.AllocatedAsSpy() {
+		return !GoodHasWon(game)
+	}
+	return GoodHasWon(game)
+}
+
+func (card definedCard) PermittedActions(game data.Game, proposal data.Proposal) map[string]bool {
+	actions := map[string]bool {
+		"Success": false,
+		"Failure": false,
+	}
+	if len(card.def.Actions) == 0 {
+		actions["Success"] = true
+		actions["Failure"] = card.AllocatedAsSpy()
+		return actions
+	}
+	for _, action := range card.def.Actions {
+		actions[action] = true
+	}
+	return actions
+}
+
+func (card definedCard) Reveal(game data.Game) []data.GameReveal {
+	reveals := []data.GameReveal{}
+	pointOut := map[string]bool{}
+	for _, sees := range card.def.Sees {
+		if sees == "evil" {
+			reveals = append(reveals, RevealEvil(game, card))
+		} else {
+			pointOut[sees] = true
+		}
+	}
+	if len(pointOut) == 0 {
+		return reveals
+	}
+
+	// Cards pointed out by label are listed in seat order, so the
+	// order doesn't give away which is which
+	players := []int{}
+	found := map[string]bool{}
+	for i, role := range game.Roles {
+		label := game.Cards[role].Label()
+		if pointOut[label] {
+			players = append(players, i)
+			found[label] = true
+		}
+	}
+	if len(players) == 0 {
+		return reveals
+	}
+
+	present := []string{}
+	for _, sees := range card.def.Sees {
+		if found[sees] {
+			present = append(present, sees)
+			found[sees] = false
+		}
+	}
+	return append(reveals, data.GameReveal{
+		Label: "This is " + strings.Join(present, " or "),
+		Players: players,
+	})
+}
+
+func (card definedCard) HiddenFrom(game data.Game, other data.CardOps) bool {
+	for _, label := range card.def.HiddenFrom {
+		if label == "*" || label == other.Label() {
+			return true
+		}
+	}
+	return false
+}
+
+func (card definedCard) Requires() []string {
+	return card.def.Requires
+}
+
+func (card definedCard) Wants() []string {
+	return card.def.Wants
+}
+
+func (card definedCard) Excludes() []string {
+	return card.def.Excludes
+}
+
+func AddCardDefinition(def CardDefinition) error {
+	if def.Label == "" {
+		return errors.New("Card definition has no label")
+	}
+	if def.Team != "good" && def.Team != "evil" {
+		return errors.New("Card " + def.Label + " has invalid team " + def.Team)
+	}
+	if _, ok := CardFactory[def.Label]; ok {
+		return errors.New("Card " + def.Label + " is defined twice")
+	}
+
+	pdef := &def
+	addCardCtor(func() data.CardOps { return definedCard{pdef} })
+	return nil
+}
+
+// This reads a JSON list of CardDefinitions and registers each of them
+func LoadCardDefinitions(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var defs []CardDefinition
+	err = json.NewDecoder(f).Decode(&defs)
+	if err != nil {
+		return err
+	}
+
+	for _, def := range defs {
+		err = AddCardDefinition(def)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package cards
+
+import (
+	"avalon/data"
+	"errors"
+)
+
+type CardInfo struct {
+	Label string `json:"label"`
+	Team string `json:"team"`
+	Maximum int `json:"maximum"`
+	Description string `json:"description"`
+	Notes []string `json:"notes"`
+}
+
+func GetCardInfo(card data.CardOps) CardInfo {
+	team := "good"
+	if card.AllocatedAsSpy() {
+		team = "evil"
+	}
+	notes := card.Notes()
+	if notes == nil {
+		notes = []string{}
+	}
+	return CardInfo{
+		Label: card.Label(),
+		Team: team,
+		Maximum: card.Maximum(),
+		Description: card.Description(),
+		Notes: notes,
+	}
+}
+
+// This builds a game with one seat per card, where seat i holds card
+// i, for asking cards questions about a card set before a real game
+// exists
+func MakeDummyGame(labels []string) (data.Game, error) {
+	game := data.Game{
+		GameStatic: data.GameStatic{
+			Setup: data.GetSizeSetup(len(labels)),
+			Roles: make([]int, len(labels)),
+		},
+		State: &data.GameState{
+			DataVersion: 1,
+			MissionsComplete: make([]bool, 5),
+			AssassinTarget: -1,
+		},
+		Cards: make([]data.CardOps, len(labels)),
+	}
+	game.Setup.Cards = labels
+
+	for i, label := range labels {
+		ctor, ok := CardFactory[label]
+		if !ok {
+			return game, errors.New("Invalid card " + label)
+		}
+		game.Cards[i] = ctor()
+		game.Roles[i] = i
+	}
+	return game, nil
+}
+
+type KnowledgeReveal struct {
+	Label string `json:"label"`
+	// These are indexes into the card set
+	Cards []int `json:"cards"`
+}
+
+type CardKnowledge struct {
+	Card CardInfo `json:"card"`
+	// What this card is shown at the start of the game
+	Reveals []KnowledgeReveal `json:"reveals"`
+	// The other cards which this card is hidden from
+	HiddenFrom []int `json:"hidden_from"`
+}
+
+// This works out who sees whom for a proposed card set, by asking
+// each card's Reveal and HiddenFrom about a dummy game
+func GetKnowledge(labels []string) ([]CardKnowledge, error) {
+	game, err := MakeDummyGame(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	knowledge := make([]CardKnowledge, len(game.Cards))
+	for i, card := range game.Cards {
+		knowledge[i].Card = GetCardInfo(card)
+
+		knowledge[i].Reveals = []KnowledgeReveal{}
+		for _, reveal := range card.Reveal(game) {
+			knowledge[i].Reveals = append(knowledge[i].Reveals, KnowledgeReveal{
+				Label: reveal.Label,
+				Cards: reveal.Players,
+			})
+		}
+
+		knowledge[i].HiddenFrom = []int{}
+		for j, other := range game.Cards {
+			if i != j && card.HiddenFrom(game, other) {
+				knowledge[i].HiddenFrom = append(knowledge[i].HiddenFrom, j)
+			}
+		}
+	}
+	return knowledge, nil
+}
@@ -0,0 +1,208 @@
+package cards
+
+import (
+	"avalon/data"
+	"errors"
+	"strconv"
+)
+
+// This checks a full card set, returning the problems which make it
+// unplayable and warnings about ones which merely make it a poor game
+func CheckCardSet(labels []string) ([]string, []string) {
+	problems := []string{}
+	warnings := []string{}
+
+	setup := data.GetSizeSetup(len(labels))
+	if len(setup.Missions) == 0 {
+		return append(problems, "Invalid number of players"), warnings
+	}
+
+	// cardops has one of each distinct card
+	cardCounts := map[string]int{}
+	cardops := make([]data.CardOps, 0, len(labels))
+	evilCount := 0
+	for _, label := range labels {
+		ctor, ok := CardFactory[label]
+		if !ok {
+			problems = append(problems, "Invalid card " + label)
+			continue
+		}
+		card := ctor()
+		if cardCounts[label] == 0 {
+			cardops = append(cardops, card)
+		}
+		cardCounts[label] = cardCounts[label] + 1
+		if card.AllocatedAsSpy() {
+			evilCount++
+		}
+	}
+
+	assassinPriority := 0
+	for _, card := range cardops {
+		if card.Maximum() > 0 && card.Maximum() < cardCounts[card.Label()] {
+			problems = append(problems, "Too many copies of " + card.Label())
+		}
+
+		if card.AssassinPriority() > assassinPriority {
+			assassinPriority = card.AssassinPriority()
+		}
+
+		constraints, ok := card.(data.CardConstraints)
+		if !ok {
+			continue
+		}
+		for _, other := range constraints.Requires() {
+			if cardCounts[other] == 0 {
+				problems = append(problems, card.Label() + " requires " + other + " in play")
+			}
+		}
+		for _, other := range constraints.Excludes() {
+			if cardCounts[other] > 0 {
+				problems = append(problems, card.Label() + " cannot be played with " + other)
+			}
+		}
+		for _, other := range constraints.Wants() {
+			if cardCounts[other] == 0 {
+				warnings = append(warnings, card.Label() + " does nothing without " + other)
+			}
+		}
+	}
+
+	if evilCount != setup.Spies {
+		problems = append(problems, "Wrong number of evil cards for this number of players")
+	}
+
+	if cardCounts["Merlin"] > 0 && assassinPriority == 0 {
+		problems = append(problems, "Must have an assassin with Merlin in play")
+	}
+
+	return problems, warnings
+}
+
+// This pads out labels to a full card set for the given number of
+// players with the filler cards, adding an Assassin if Merlin needs
+// one, the same way the setup screen does
+func FillCardSet(players int, labels []string) ([]string, error) {
+	setup := data.GetSizeSetup(players)
+	if len(setup.Missions) == 0 {
+		return nil, errors.New("Invalid number of players " + strconv.Itoa(players))
+	}
+
+	filled := append([]string{}, labels...)
+	spies := 0
+	haveMerlin := false
+	haveAssassin := false
+	for _, label := range labels {
+		ctor, ok := CardFactory[label]
+		if !ok {
+			return nil, errors.New("Invalid card " + label)
+		}
+		card := ctor()
+		if card.AllocatedAsSpy() {
+			spies++
+		}
+		if card.AssassinPriority() > 0 {
+			haveAssassin = true
+		}
+		if label == "Merlin" {
+			haveMerlin = true
+		}
+	}
+
+	if haveMerlin && !haveAssassin && spies < setup.Spies {
+		filled = append(filled, "Assassin")
+		spies++
+	}
+	for ; spies < setup.Spies; spies++ {
+		filled = append(filled, "Evil")
+	}
+	for len(filled) < players {
+		filled = append(filled, "Good")
+	}
+	if len(filled) > players || spies > setup.Spies {
+		return nil, errors.New("Too many cards for " + strconv.Itoa(players) + " players")
+	}
+
+	return filled, nil
+}
+
+// This fills out a card set for the given number of players with the
+// standard cards, starting from the cards already chosen. It adds the
+// cards those want, then Merlin and the Assassin, and Percival and
+// Morgana from seven players, where there is room, and then the filler
+// cards. It knows nothing of how balanced the result is; avalon-sim
+// and /stats/cards do.
+func StandardCardSet(players int, labels []string) ([]string, error) {
+	setup := data.GetSizeSetup(players)
+	if len(setup.Missions) == 0 {
+		return nil, errors.New("Invalid number of players " + strconv.Itoa(players))
+	}
+
+	chosen := append([]string{}, labels...)
+	counts := map[string]int{}
+	free := map[bool]int{false: players - setup.Spies, true: setup.Spies}
+	haveAssassin := func() bool {
+		for label := range counts {
+			if CardFactory[label]().AssassinPriority() > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(label string) bool {
+		ctor, ok := CardFactory[label]
+		if !ok {
+			return false
+		}
+		card := ctor()
+		if free[card.AllocatedAsSpy()] == 0 || (card.Maximum() > 0 && counts[label] >= card.Maximum()) {
+			return false
+		}
+		// Don't add Merlin unless there is room for an assassin too
+		if label == "Merlin" && !haveAssassin() && free[true] == 0 {
+			return false
+		}
+		free[card.AllocatedAsSpy()]--
+		counts[label]++
+		return true
+	}
+	for _, label := range labels {
+		if !add(label) {
+			return nil, errors.New("No room for " + label)
+		}
+	}
+
+	standard := []string{"Merlin", "Assassin"}
+	if players >= 7 {
+		standard = append(standard, "Percival", "Morgana")
+	}
+
+	// Keep going until nothing more gets added, since the cards we
+	// add may want others in turn
+	for added := true; added; {
+		added = false
+		for _, label := range chosen {
+			constraints, ok := CardFactory[label]().(data.CardConstraints)
+			if !ok {
+				continue
+			}
+			for _, other := range append(constraints.Requires(), constraints.Wants()...) {
+				if counts[other] == 0 && add(other) {
+					chosen = append(chosen, other)
+					added = true
+				}
+			}
+		}
+		for _, label := range standard {
+			if label == "Assassin" && (counts["Merlin"] == 0 || haveAssassin()) {
+				continue
+			}
+			if counts[label] == 0 && add(label) {
+				chosen = append(chosen, label)
+				added = true
+			}
+		}
+	}
+
+	return FillCardSet(players, chosen)
+}
@@ -14,6 +14,11 @@ type GameReveal struct {
 type CardOps interface {
 	// This returns the card's label
 	Label() string
+	// This returns a sentence or two describing the card, for the
+	// setup screen
+	Description() string
+	// This returns any rules notes worth showing at setup
+	Notes() []string
 	// This is true if the card takes up a spy slot during game creation
 	AllocatedAsSpy() bool
 	// Maximum number of copies of this card which may be used in the
@@ -33,6 +38,106 @@ type CardOps interface {
 	HiddenFrom(Game, CardOps) bool
 }
 
+// Cards may implement this to declare how they combine with others
+// in a card set
+type CardConstraints interface {
+	// Labels of cards which must also be in play
+	Requires() []string
+	// Labels of cards without which this card does nothing
+	Wants() []string
+	// Labels of cards which must not be in play alongside this one
+	Excludes() []string
+}
+
+// A Decision is a choice a card's phase hook has asked a seat to
+// make, from a list of players. Decisions do not hold up the game.
+type Decision struct {
+	Id int64 `json:"id" datastore:"-"`
+	Seat int `json:"-"`
+	Kind string `json:"kind"`
+	Label string `json:"label"`
+	Players []int `json:"players"`
+	Resolved bool `json:"-"`
+	Choice int `json:"-"`
+}
+
+// This is what a phase hook returns: private reveals and decisions
+// for the seat the hook was called for
+type PhaseResult struct {
+	Reveals []GameReveal
+	Decisions []Decision
+}
+
+// Cards may implement any of these to be called by gameplay at the
+// phase boundaries, once for each seat holding the card
+type PickingHook interface {
+	// Called before the leader picks a team
+	BeforePicking(game Game, seat int) PhaseResult
+}
+
+type VoteHook interface {
+	// Called after all the votes on a proposal are in
+	AfterVote(game Game, seat int, result VoteResult) PhaseResult
+}
+
+type MissionHook interface {
+	// Called after all the actions on a mission are in
+	AfterMission(game Game, seat int, result MissionResult) PhaseResult
+}
+
+type GameOverHook interface {
+	// Called before the game is marked as over
+	BeforeGameOver(game Game, seat int) PhaseResult
+}
+
+type DecisionHook interface {
+	// Called when the seat makes one of this card's decisions
+	Decide(game Game, seat int, decision Decision, choice int) PhaseResult
+}
+
+// These call a phase hook for the card in every seat, and return
+// what it produced for each seat. Seats whose card doesn't implement
+// the hook get an empty PhaseResult.
+func (game Game) BeforePicking() []PhaseResult {
+	results := make([]PhaseResult, len(game.Roles))
+	for seat, role := range game.Roles {
+		if hook, ok := game.Cards[role].(PickingHook); ok {
+			results[seat] = hook.BeforePicking(game, seat)
+		}
+	}
+	return results
+}
+
+func (game Game) AfterVote(result VoteResult) []PhaseResult {
+	results := make([]PhaseResult, len(game.Roles))
+	for seat, role := range game.Roles {
+		if hook, ok := game.Cards[role].(VoteHook); ok {
+			results[seat] = hook.AfterVote(game, seat, result)
+		}
+	}
+	return results
+}
+
+func (game Game) AfterMission(result MissionResult) []PhaseResult {
+	results := make([]PhaseResult, len(game.Roles))
+	for seat, role := range game.Roles {
+		if hook, ok := game.Cards[role].(MissionHook); ok {
+			results[seat] = hook.AfterMission(game, seat, result)
+		}
+	}
+	return results
+}
+
+func (game Game) BeforeGameOver() []PhaseResult {
+	results := make([]PhaseResult, len(game.Roles))
+	for seat, role := range game.Roles {
+		if hook, ok := game.Cards[role].(GameOverHook); ok {
+			results[seat] = hook.BeforeGameOver(game, seat)
+		}
+	}
+	return results
+}
+
 type Mission struct {
 	Size int `json:"size"`
 	FailsAllowed int `json:"fails_allowed"`
@@ -45,6 +150,9 @@ type GameSetup struct {
 }
 
 type Proposal struct {
+	// See GameState.DataVersion
+	DataVersion int
+
 	Leader int
 	Players []int
 	Votes []bool
@@ -52,7 +160,7 @@ type Proposal struct {
 }
 
 type GameState struct {
-	// This is used to manage data migrations
+	// This is used to manage data migrations - see db.AddMigration
 	DataVersion int
 
 	// These value are updated by a completed proposal
@@ -75,12 +183,17 @@ type GameState struct {
 
 type GameStatic struct {
 	Id string
-	Hangout string
+	// Rooms were Hangouts before there were rooms
+	Room string `datastore:"Hangout"`
 	StartTime time.Time
 	Setup GameSetup
 	UserIDs []string
 	AIs []int
 	Roles []int
+	// These are only set for games in a series: its ID, and which of
+	// its participants is in each seat
+	Series string
+	SeriesSeats []int
 }
 
 type Game struct {
@@ -90,6 +203,9 @@ type Game struct {
 }
 
 type Actions struct {
+	// See GameState.DataVersion
+	DataVersion int
+
 	Mission int
 	Proposal int
 	Actions []bool
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"time"
+)
+
+// This is bumped whenever the layout of GameExport changes
+const ExportFormatVersion = 2
+
+// A GameExport is everything stored for one game, as a single JSON
+// document. DataVersion is the version that the entities in it have
+// been migrated to (see GameState.DataVersion).
+type GameExport struct {
+	FormatVersion int `json:"format_version"`
+	DataVersion int `json:"data_version"`
+	Exported time.Time `json:"exported"`
+
+	Game GameStatic `json:"game"`
+	State GameState `json:"state"`
+	// Seats with no player ID stored are left empty
+	PlayerIDs []string `json:"player_ids"`
+	Proposals []ProposalExport `json:"proposals"`
+	Actions []ActionsExport `json:"actions"`
+	VoteResults []VoteResult `json:"vote_results"`
+	MissionResults []MissionResult `json:"mission_results"`
+	SeatReveals []SeatRevealExport `json:"seat_reveals"`
+	Decisions []DecisionExport `json:"decisions"`
+}
+
+type ProposalExport struct {
+	Mission int `json:"mission"`
+	Proposal int `json:"proposal"`
+	Value Proposal `json:"value"`
+}
+
+type ActionsExport struct {
+	Mission int `json:"mission"`
+	Value Actions `json:"value"`
+}
+
+type SeatRevealExport struct {
+	Seat int `json:"seat"`
+	Created time.Time `json:"created"`
+	Reveal GameReveal `json:"reveal"`
+}
+
+// Decision hides who it belongs to and how it was resolved from the
+// players, so this has all of it
+type DecisionExport struct {
+	Id int64 `json:"id"`
+	Seat int `json:"seat"`
+	Kind string `json:"kind"`
+	Label string `json:"label"`
+	Players []int `json:"players"`
+	Resolved bool `json:"resolved"`
+	Choice int `json:"choice"`
+}
@@ -0,0 +1,23 @@
+package data
+
+import (
+	"strings"
+	"time"
+)
+
+// Guests' user IDs all start with this
+const GuestPrefix = "guest:"
+
+func IsGuest(userid string) bool {
+	return strings.HasPrefix(userid, GuestPrefix)
+}
+
+// A Guest is somebody playing without an account, known by a cookie.
+// Once they are upgraded to an account the cookie no longer works, and
+// UpgradedTo is the account's user ID.
+type Guest struct {
+	UserID string
+	Name string
+	Created time.Time
+	UpgradedTo string
+}
@@ -0,0 +1,39 @@
+package data
+
+import (
+	"time"
+)
+
+// A Rating is a player's skill, kept separately for each side. Scope
+// is "" for the global ratings, or a room ID for ratings within
+// that room.
+type Rating struct {
+	UserID string `json:"userid"`
+	Scope string `json:"scope"`
+	// Guests are rated, but kept off the leaderboard unless asked for
+	Guest bool `json:"guest"`
+
+	Good float64 `json:"good"`
+	GoodGames int `json:"good_games"`
+	GoodWins int `json:"good_wins"`
+
+	Evil float64 `json:"evil"`
+	EvilGames int `json:"evil_games"`
+	EvilWins int `json:"evil_wins"`
+
+	// The mean of the two, stored so the leaderboard can sort on it
+	Overall float64 `json:"overall"`
+
+	Updated time.Time `json:"updated"`
+}
+
+// An Achievement is one player's record of earning one achievement
+type Achievement struct {
+	UserID string `json:"-"`
+	Id string `json:"id"`
+	Count int `json:"count"`
+	FirstGame string `json:"first_game"`
+	FirstTime time.Time `json:"first_time"`
+	LastGame string `json:"last_game"`
+	LastTime time.Time `json:"last_time"`
+}
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"time"
+)
+
+// Answers to a rematch
+const (
+	RematchAccept = "accept"
+	RematchDecline = "decline"
+)
+
+// How long players have to answer a rematch, from when it is first
+// asked for. Anybody who hasn't answered by then is left out.
+const RematchTimeout = 60 * time.Second
+
+// A Rematch collects the players' answers when a finished game is
+// played again. Responses is per seat, and is "" until the player
+// answers. AIs always accept.
+type Rematch struct {
+	Responses []string `json:"responses"`
+	Deadline time.Time `json:"deadline"`
+	// The new game, once it has started
+	Game string `json:"-"`
+}
+
+func (rematch Rematch) Answered() bool {
+	for _, response := range rematch.Responses {
+		if response == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// This is true once the rematch can go ahead without waiting for any
+// more answers
+func (rematch Rematch) Closed(now time.Time) bool {
+	return rematch.Answered() || now.After(rematch.Deadline)
+}
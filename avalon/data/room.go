@@ -0,0 +1,86 @@
+package data
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// Rooms hold at most this many players, the size of the largest game
+const MaxRoomSize = 10
+
+// A Room is where games are played, joined with its short Code. Its
+// games and series are stored under it. Rooms in Hangouts have no
+// Room entity: the hangout ID is the room ID, and whoever is in the
+// hangout is in the room.
+type Room struct {
+	Id string `json:"id"`
+	Code string `json:"code"`
+	Created time.Time `json:"created"`
+	// The host, who picks the settings and starts games. This is
+	// whoever created the room, until they leave it.
+	Owner string `json:"-"`
+
+	// The lobby: the players' names, which are their participant IDs
+	// in the room's games, their user IDs, and whether they are ready
+	// to start
+	Names []string `json:"names"`
+	UserIDs []string `json:"-"`
+	Ready []bool `json:"ready"`
+
+	// The host's settings for the next game
+	Cards []string `json:"cards"`
+	// Seats to fill with AIs
+	AIs int `json:"ais"`
+	// With Series set the game starts a series, with these options
+	// (see Series)
+	Series bool `json:"series"`
+	BestOf int `json:"best_of"`
+	FixedSeating bool `json:"fixed_seating"`
+	RotateRoles bool `json:"rotate_roles"`
+}
+
+func (room Room) LookupUserID(userid string) (int, bool) {
+	for i, v := range room.UserIDs {
+		if v == userid {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (room Room) AllReady() bool {
+	for _, ready := range room.Ready {
+		if !ready {
+			return false
+		}
+	}
+	return true
+}
+
+// This makes everybody in the lobby not ready, when the settings
+// change or a game starts
+func (room *Room) ClearReady() {
+	room.Ready = make([]bool, len(room.Names))
+}
+
+func (room Room) LookupName(name string) (int, bool) {
+	for i, v := range room.Names {
+		if v == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Join codes leave out letters and digits which look alike. There are
+// 32 of them, so taking each random byte mod 32 is not biased.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func RandomCode(length int) string {
+	b := make([]byte, length)
+	rand.Read(b)
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i]) % len(codeAlphabet)]
+	}
+	return string(b)
+}
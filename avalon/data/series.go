@@ -0,0 +1,44 @@
+package data
+
+import (
+	"time"
+)
+
+type SeriesResult struct {
+	Game string `json:"game"`
+	// "good" or "evil"
+	Winner string `json:"winner"`
+	Ending string `json:"ending"`
+}
+
+// A Series groups consecutive games in a room, played by the same
+// participants with the same cards. The per-participant slices are
+// all in the order of Names.
+type Series struct {
+	Id string `json:"id"`
+	Room string `json:"-"`
+	Created time.Time `json:"created"`
+	// The number of games to play, or 0 to keep going
+	BestOf int `json:"best_of"`
+	// With FixedSeating every game uses the seating of the first game
+	FixedSeating bool `json:"fixed_seating"`
+	// With RotateRoles evil goes to whoever has been evil least often
+	// so far, rather than at random
+	RotateRoles bool `json:"rotate_roles"`
+
+	// Participant IDs (or ai_N for AIs), and their user IDs
+	Names []string `json:"names"`
+	UserIDs []string `json:"-"`
+	Cards []string `json:"cards"`
+	// This maps seats to participants, for FixedSeating
+	Seating []int `json:"seating"`
+
+	Scores []int `json:"scores"`
+	Played []int `json:"played"`
+	EvilCounts []int `json:"evil_counts"`
+	Results []SeriesResult `json:"results"`
+}
+
+func (series Series) Over() bool {
+	return series.BestOf > 0 && len(series.Results) >= series.BestOf
+}
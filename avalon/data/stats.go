@@ -0,0 +1,28 @@
+package data
+
+import (
+	"time"
+)
+
+// A CardStat is one row of the aggregate win-rate tables: games
+// counted under one role label, player count or card set, split by
+// how they ended
+type CardStat struct {
+	// One of "role", "players" or "cardset"
+	Table string
+	Key string
+
+	// For roles this counts each seat holding the role, so a game
+	// with two of a card counts twice
+	Games int
+	Wins int
+
+	GoodMissions int
+	EvilMissions int
+	Assassinated int
+}
+
+// This marks a game as added to the card stats
+type CardStatGame struct {
+	Recorded time.Time
+}
@@ -0,0 +1,213 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// An ExportEvent is one step of a game's history, as far as it can be
+// worked out from what is stored: a proposal being made, the vote on
+// it, or a mission result
+type ExportEvent struct {
+	Index int `json:"index"`
+	// One of "proposal", "vote" or "mission"
+	Kind string `json:"kind"`
+	Mission int `json:"mission"`
+	Proposal int `json:"proposal"`
+	Description string `json:"description"`
+}
+
+func (export GameExport) findProposal(m int, p int) *Proposal {
+	for i := range export.Proposals {
+		if export.Proposals[i].Mission == m && export.Proposals[i].Proposal == p {
+			return &export.Proposals[i].Value
+		}
+	}
+	return nil
+}
+
+func (export GameExport) findVoteResult(m int, p int) *VoteResult {
+	for i := range export.VoteResults {
+		if export.VoteResults[i].Mission == m && export.VoteResults[i].Proposal == p {
+			return &export.VoteResults[i]
+		}
+	}
+	return nil
+}
+
+func (export GameExport) findMissionResult(m int) *MissionResult {
+	for i := range export.MissionResults {
+		if export.MissionResults[i].Mission == m {
+			return &export.MissionResults[i]
+		}
+	}
+	return nil
+}
+
+// This lists the events in the order they happened. Missions and
+// proposals in the descriptions are 1-based, like the ajax API.
+func (export GameExport) Events() []ExportEvent {
+	events := []ExportEvent{}
+	add := func(kind string, m int, p int, description string) {
+		events = append(events, ExportEvent{len(events), kind, m, p, description})
+	}
+
+	for m := range export.Game.Setup.Missions {
+		for p := 0; p < 5; p++ {
+			proposal := export.findProposal(m, p)
+			if proposal == nil {
+				continue
+			}
+			prefix := fmt.Sprintf("Mission %d proposal %d: ", m + 1, p + 1)
+			add("proposal", m, p, prefix + fmt.Sprintf("seat %d proposed %v", proposal.Leader, proposal.Players))
+
+			vote := export.findVoteResult(m, p)
+			if vote != nil {
+				approves := 0
+				for _, v := range vote.Votes {
+					if v {
+						approves++
+					}
+				}
+				add("vote", m, p, prefix + fmt.Sprintf("vote %d, %d of %d approved", vote.Index + 1, approves, len(vote.Votes)))
+			}
+		}
+
+		result := export.findMissionResult(m)
+		if result != nil {
+			add("mission", m, result.Proposal, fmt.Sprintf("Mission %d: %d fails, %d allowed", m + 1, result.Fails, result.FailsAllowed))
+		}
+	}
+
+	return events
+}
+
+func nextSeat(export GameExport, seat int) int {
+	seat++
+	if seat >= len(export.Game.Roles) {
+		seat = 0
+	}
+	return seat
+}
+
+// This returns the game as it stood straight after the given event,
+// with everything that came later removed and the game state worked
+// out again. Which seat acted when is not stored, so a truncated
+// mission has nobody acted, and seat reveals and decisions (which
+// can't be placed among the events) are dropped. hasAssassin is
+// whether the game's cards include an assassin.
+func (export GameExport) Truncate(event int, hasAssassin bool) (GameExport, error) {
+	events := export.Events()
+	if event < 0 || event >= len(events) {
+		return export, errors.New("No such event " + strconv.Itoa(event))
+	}
+
+	truncated := export
+	truncated.Proposals = []ProposalExport{}
+	truncated.Actions = []ActionsExport{}
+	truncated.VoteResults = []VoteResult{}
+	truncated.MissionResults = []MissionResult{}
+	truncated.SeatReveals = []SeatRevealExport{}
+	truncated.Decisions = []DecisionExport{}
+
+	state := GameState{
+		DataVersion: export.State.DataVersion,
+		MissionsComplete: make([]bool, len(export.Game.Setup.Missions)),
+		AssassinTarget: -1,
+		Leader: export.State.Leader,
+	}
+
+	startMission := func(m int, p int) {
+		size := export.Game.Setup.Missions[m].Size
+		truncated.Actions = append(truncated.Actions, ActionsExport{m, Actions{
+			DataVersion: export.State.DataVersion,
+			Mission: m,
+			Proposal: p,
+			Actions: make([]bool, size),
+			Acted: make([]bool, size),
+		}})
+		state.HaveActions = true
+	}
+
+	for _, e := range events[:event + 1] {
+		switch e.Kind {
+		case "proposal":
+			proposal := *export.findProposal(e.Mission, e.Proposal)
+			state.ThisMission = e.Mission
+			state.ThisProposal = e.Proposal
+			state.Leader = proposal.Leader
+			state.HaveProposal = true
+			state.HaveActions = false
+			if e.Proposal != 4 {
+				// The votes come with the vote event
+				proposal.Votes = make([]bool, len(export.Game.Roles))
+				proposal.Voted = make([]bool, len(export.Game.Roles))
+			}
+			truncated.Proposals = append(truncated.Proposals, ProposalExport{e.Mission, e.Proposal, proposal})
+			if e.Proposal == 4 {
+				startMission(e.Mission, e.Proposal)
+			}
+
+		case "vote":
+			vote := *export.findVoteResult(e.Mission, e.Proposal)
+			truncated.VoteResults = append(truncated.VoteResults, vote)
+			last := &truncated.Proposals[len(truncated.Proposals) - 1]
+			last.Value.Votes = vote.Votes
+			last.Value.Voted = make([]bool, len(vote.Votes))
+			approves := 0
+			for i, v := range vote.Votes {
+				last.Value.Voted[i] = true
+				if v {
+					approves++
+				}
+			}
+			state.ThisVote = vote.Index + 1
+			if approves > len(vote.Votes) - approves {
+				startMission(e.Mission, e.Proposal)
+			} else {
+				state.ThisProposal++
+				state.Leader = nextSeat(export, vote.Leader)
+				state.HaveProposal = false
+			}
+
+		case "mission":
+			result := *export.findMissionResult(e.Mission)
+			truncated.MissionResults = append(truncated.MissionResults, result)
+			// The mission is over, so the real actions can go in
+			kept := []ActionsExport{}
+			for _, actions := range truncated.Actions {
+				if actions.Mission != e.Mission {
+					kept = append(kept, actions)
+				}
+			}
+			for _, actions := range export.Actions {
+				if actions.Mission == e.Mission {
+					kept = append(kept, actions)
+				}
+			}
+			truncated.Actions = kept
+			state.MissionsComplete[e.Mission] = true
+			if result.Fails > result.FailsAllowed {
+				state.EvilScore++
+			} else {
+				state.GoodScore++
+			}
+
+			if state.GoodScore >= 3 || state.EvilScore >= 3 {
+				// With an assassin, good winning on points leaves the
+				// game waiting for the assassination
+				state.GameOver = state.EvilScore >= 3 || !hasAssassin
+				continue
+			}
+			state.Leader = nextSeat(export, result.Leader)
+			state.ThisProposal = 0
+			state.ThisMission++
+			state.HaveProposal = false
+			state.HaveActions = false
+		}
+	}
+
+	truncated.State = state
+	return truncated, nil
+}
@@ -0,0 +1,14 @@
+package data
+
+import (
+	"time"
+)
+
+// A PasswordUser is an account with the password authentication
+// provider. Hash has the salt and parameters in it.
+type PasswordUser struct {
+	Username string
+	Hash string
+	UserID string
+	Created time.Time
+}
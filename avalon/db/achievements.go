@@ -0,0 +1,37 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+)
+
+func makeAchievementKey(c appengine.Context, userid string, id string) *datastore.Key {
+	return datastore.NewKey(c, "Achievement", id, 0, makePlayerKey(c, userid))
+}
+
+// This returns nil if the player hasn't earned the achievement
+func GetAchievement(c appengine.Context, userid string, id string) (*data.Achievement, error) {
+	var achievement data.Achievement
+	err := datastore.Get(c, makeAchievementKey(c, userid, id), &achievement)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	return &achievement, err
+}
+
+func StoreAchievement(c appengine.Context, achievement data.Achievement) error {
+	_, err := datastore.Put(c, makeAchievementKey(c, achievement.UserID, achievement.Id), &achievement)
+	return err
+}
+
+func DeleteAchievement(c appengine.Context, achievement data.Achievement) error {
+	return datastore.Delete(c, makeAchievementKey(c, achievement.UserID, achievement.Id))
+}
+
+func GetAchievements(c appengine.Context, userid string) ([]data.Achievement, error) {
+	q := datastore.NewQuery("Achievement").Ancestor(makePlayerKey(c, userid))
+	achievements := []data.Achievement{}
+	_, err := q.GetAll(c, &achievements)
+	return achievements, err
+}
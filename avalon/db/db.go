@@ -51,14 +51,14 @@ func cacheDeleteObject(c appengine.Context, kind string, cacheKey string) error
 }
 
 func makeGameKey(c appengine.Context, game data.Game) *datastore.Key {
-	hangoutKey := datastore.NewKey(c, "Hangout", game.Hangout, 0, nil)
-	gameKey := datastore.NewKey(c, "Game", game.Id, 0, hangoutKey)
+	roomKey := makeRoomKey(c, game.Room)
+	gameKey := datastore.NewKey(c, "Game", game.Id, 0, roomKey)
 	return gameKey
 }
 
 func makeGameStateKey(c appengine.Context, game data.Game) *datastore.Key {
-	hangoutKey := datastore.NewKey(c, "Hangout", game.Hangout, 0, nil)
-	gameKey := datastore.NewKey(c, "GameState", game.Id, 0, hangoutKey)
+	roomKey := makeRoomKey(c, game.Room)
+	gameKey := datastore.NewKey(c, "GameState", game.Id, 0, roomKey)
 	return gameKey
 }
 
@@ -66,10 +66,10 @@ type GameFactory func(string, string) (data.Game, []string)
 
 // Call with factory == nil to find and never create. With factory !=
 // nil this function always returns a game or an error
-func FindOrCreateGame(c appengine.Context, hangout string, factory GameFactory) (*data.Game, error) {
-	hangoutKey := datastore.NewKey(c, "Hangout", hangout, 0, nil)
-	// We will select the most recently stated game in this hangout
-	q := datastore.NewQuery("Game").Ancestor(hangoutKey).Order("-StartTime").Limit(1)
+func FindOrCreateGame(c appengine.Context, room string, factory GameFactory) (*data.Game, error) {
+	roomKey := makeRoomKey(c, room)
+	// We will select the most recently stated game in this room
+	q := datastore.NewQuery("Game").Ancestor(roomKey).Order("-StartTime").Limit(1)
 	var games []data.GameStatic
 	_, err := q.GetAll(c, &games)
 	if err != nil {
@@ -96,7 +96,7 @@ func FindOrCreateGame(c appengine.Context, hangout string, factory GameFactory)
 	var gameid string
 	for {
 		gameid = data.RandomString(64)
-		oldgame, err := RetrieveGameStatic(c, hangout, gameid)
+		oldgame, err := RetrieveGameStatic(c, room, gameid)
 		if err != nil {
 			return nil, err
 		}
@@ -105,7 +105,7 @@ func FindOrCreateGame(c appengine.Context, hangout string, factory GameFactory)
 		}
 	}
 
-	game, playerids := factory(gameid, hangout)
+	game, playerids := factory(gameid, room)
 	fillCardOps(&game)
 
 	err = privStoreGame(c, game)
@@ -128,14 +128,17 @@ func FindOrCreateGame(c appengine.Context, hangout string, factory GameFactory)
 	return &game, nil
 }
 
-func gameStaticCacheKey(hangoutid string, gameid string) string {
-	return makeCacheKey("GameStatic", hangoutid, gameid)
+func gameStaticCacheKey(roomid string, gameid string) string {
+	return makeCacheKey("GameStatic", roomid, gameid)
 }
 
-func cacheGetGameStatic(c appengine.Context, hangoutid string, gameid string) *data.GameStatic {
+func cacheGetGameStatic(c appengine.Context, roomid string, gameid string) *data.GameStatic {
 	var static data.GameStatic
-	ok := cacheGetObject(c, "GameStatic", gameStaticCacheKey(hangoutid, gameid), &static)
+	ok := cacheGetObject(c, "GameStatic", gameStaticCacheKey(roomid, gameid), &static)
 	if ok {
+		// Entries cached before rooms have no Room, but the key
+		// says which room they are in
+		static.Room = roomid
 		return &static
 	} else {
 		return nil
@@ -143,7 +146,7 @@ func cacheGetGameStatic(c appengine.Context, hangoutid string, gameid string) *d
 }
 
 func cacheSetGameStatic(c appengine.Context, gamestatic data.GameStatic) {
-	cacheSetObject(c, "GameStatic", gameStaticCacheKey(gamestatic.Hangout, gamestatic.Id), 600, gamestatic)
+	cacheSetObject(c, "GameStatic", gameStaticCacheKey(gamestatic.Room, gamestatic.Id), 600, gamestatic)
 }
 
 func privStoreGame(c appengine.Context, game data.Game) error {
@@ -152,15 +155,15 @@ func privStoreGame(c appengine.Context, game data.Game) error {
 	return err
 }
 
-func RetrieveGameStatic(c appengine.Context, hangoutid string, gameid string) (*data.GameStatic, error) {
-	pgame := cacheGetGameStatic(c, hangoutid, gameid)
+func RetrieveGameStatic(c appengine.Context, roomid string, gameid string) (*data.GameStatic, error) {
+	pgame := cacheGetGameStatic(c, roomid, gameid)
 	if pgame != nil {
 		return pgame, nil
 	}
 
 	var game data.GameStatic
-	hangoutKey := datastore.NewKey(c, "Hangout", hangoutid, 0, nil)
-	gameKey := datastore.NewKey(c, "Game", gameid, 0, hangoutKey)
+	roomKey := makeRoomKey(c, roomid)
+	gameKey := datastore.NewKey(c, "Game", gameid, 0, roomKey)
 	err := datastore.Get(c, gameKey, &game)
 	if err == datastore.ErrNoSuchEntity {
 		return nil, nil
@@ -170,7 +173,7 @@ func RetrieveGameStatic(c appengine.Context, hangoutid string, gameid string) (*
 }
 
 func gameStateCacheKey(game data.Game) string {
-	return makeCacheKey("GameState", game.Hangout, game.Id)
+	return makeCacheKey("GameState", game.Room, game.Id)
 }
 
 func cacheGetGameState(c appengine.Context, game data.Game) *data.GameState {
@@ -196,6 +199,7 @@ func cacheDeleteGameState(c appengine.Context, game data.Game) error {
 }
 
 func StoreGameState(c appengine.Context, game data.Game) error {
+	game.State.DataVersion = CurrentDataVersion()
 	gameStateKey := makeGameStateKey(c, game)
 	_, err := datastore.Put(c, gameStateKey, game.State)
 	return err
@@ -208,6 +212,7 @@ func EnsureGameState(c appengine.Context, game *data.Game, uncached bool) error
 	if !uncached {
 		pstate := cacheGetGameState(c, *game)
 		if pstate != nil {
+			migrateGameState(*game, pstate)
 			game.State = pstate
 			return nil
 		}
@@ -217,6 +222,7 @@ func EnsureGameState(c appengine.Context, game *data.Game, uncached bool) error
 	var state data.GameState
 	err := datastore.Get(c, gameStateKey, &state)
 	if err == nil {
+		migrateGameState(*game, &state)
 		game.State = &state
 		if !uncached {
 			cacheSetGameState(c, *game)
@@ -251,8 +257,8 @@ func fillCardOps(game *data.Game) {
 	}
 }
 
-func RetrieveGame(c appengine.Context, hangoutid string, gameid string) (*data.Game, error) {
-	gamestatic, err := RetrieveGameStatic(c, hangoutid, gameid)
+func RetrieveGame(c appengine.Context, roomid string, gameid string) (*data.Game, error) {
+	gamestatic, err := RetrieveGameStatic(c, roomid, gameid)
 	if err != nil {
 		return nil, err
 	}
@@ -280,7 +286,7 @@ type StringStore struct {
 }
 
 func playerIDCacheKey(game data.Game, pos int) string {
-	return makeCacheKey("playerID", game.Hangout, game.Id, strconv.Itoa(pos))
+	return makeCacheKey("playerID", game.Room, game.Id, strconv.Itoa(pos))
 }
 
 func cacheGetPlayerID(c appengine.Context, game data.Game, pos int) string {
@@ -360,7 +366,7 @@ func GetPlayerIDs(c appengine.Context, game data.Game) ([]string, error) {
 }
 
 func proposalCacheKey(game data.Game, m int, p int) string {
-	return makeCacheKey("proposal", game.Hangout, game.Id, strconv.Itoa(m), strconv.Itoa(p))
+	return makeCacheKey("proposal", game.Room, game.Id, strconv.Itoa(m), strconv.Itoa(p))
 }
 
 func cacheGetProposal(c appengine.Context, game data.Game, m int, p int) *data.Proposal {
@@ -386,6 +392,7 @@ func cacheDeleteProposal(c appengine.Context, game data.Game, m int, p int) erro
 }
 
 func StoreProposal(c appengine.Context, game data.Game, m int, p int, proposal data.Proposal) error {
+	proposal.DataVersion = CurrentDataVersion()
 	gameKey := makeGameKey(c, game)
 	missionKey := datastore.NewKey(c, "Mission", "", int64(1000 + m), gameKey)
 	proposalKey := datastore.NewKey(c, "Proposal", "", int64(1000 + p), missionKey)
@@ -397,6 +404,7 @@ func GetProposal(c appengine.Context, uncached bool, game data.Game, m int, p in
 	if !uncached {
 		pproposal := cacheGetProposal(c, game, m, p)
 		if pproposal != nil {
+			migrateProposal(game, m, p, pproposal)
 			return pproposal, nil
 		}
 	}
@@ -409,6 +417,7 @@ func GetProposal(c appengine.Context, uncached bool, game data.Game, m int, p in
 	if err == datastore.ErrNoSuchEntity {
 		return nil, nil
 	}
+	migrateProposal(game, m, p, &proposal)
 	if err == nil && !uncached {
 		cacheSetProposal(c, game, m, p, proposal)
 	}
@@ -416,7 +425,7 @@ func GetProposal(c appengine.Context, uncached bool, game data.Game, m int, p in
 }
 
 func actionsCacheKey(game data.Game, m int) string {
-	return makeCacheKey("actions", game.Hangout, game.Id, strconv.Itoa(m))
+	return makeCacheKey("actions", game.Room, game.Id, strconv.Itoa(m))
 }
 
 func cacheGetActions(c appengine.Context, game data.Game, m int) *data.Actions {
@@ -442,6 +451,7 @@ func cacheDeleteActions(c appengine.Context, game data.Game, m int) error {
 }
 
 func StoreActions(c appengine.Context, game data.Game, m int, actions data.Actions) error {
+	actions.DataVersion = CurrentDataVersion()
 	gameKey := makeGameKey(c, game)
 	actionsKey := datastore.NewKey(c, "Actions", "", int64(1000 + m), gameKey)
 	_, err := datastore.Put(c, actionsKey, &actions)
@@ -452,6 +462,7 @@ func GetActions(c appengine.Context, uncached bool, game data.Game, m int) (*dat
 	if !uncached {
 		pactions := cacheGetActions(c, game, m)
 		if pactions != nil {
+			migrateActions(game, m, pactions)
 			return pactions, nil
 		}
 	}
@@ -464,6 +475,7 @@ func GetActions(c appengine.Context, uncached bool, game data.Game, m int) (*dat
 	if err == datastore.ErrNoSuchEntity {
 		return nil, nil
 	}
+	migrateActions(game, m, &actions)
 	if err == nil && !uncached {
 		cacheSetActions(c, game, m, actions)
 	}
@@ -471,7 +483,7 @@ func GetActions(c appengine.Context, uncached bool, game data.Game, m int) (*dat
 }
 
 func missionResultCacheKey(game data.Game, m int) string {
-	return makeCacheKey("missionResult", game.Hangout, game.Id, strconv.Itoa(m))
+	return makeCacheKey("missionResult", game.Room, game.Id, strconv.Itoa(m))
 }
 
 func cacheGetMissionResult(c appengine.Context, game data.Game, m int) *data.MissionResult {
@@ -529,7 +541,7 @@ func GetMissionResults(c appengine.Context, game data.Game) ([]*data.MissionResu
 }
 
 func voteResultCacheKey(game data.Game, r int) string {
-	return makeCacheKey("voteResult", game.Hangout, game.Id, strconv.Itoa(r))
+	return makeCacheKey("voteResult", game.Room, game.Id, strconv.Itoa(r))
 }
 
 func cacheGetVoteResult(c appengine.Context, game data.Game, r int) *data.VoteResult {
@@ -583,3 +595,77 @@ func GetVoteResults(c appengine.Context, game data.Game) ([]data.VoteResult, err
 	}
 	return results, nil
 }
+
+type seatReveal struct {
+	Seat int
+	Created time.Time
+	data.GameReveal
+}
+
+// Seat reveals and decisions come from phase hooks, and are read
+// inside transactions, so these are never cached
+func StoreSeatReveal(c appengine.Context, game data.Game, seat int, reveal data.GameReveal) error {
+	gameKey := makeGameKey(c, game)
+	revealKey := datastore.NewIncompleteKey(c, "SeatReveal", gameKey)
+	value := seatReveal{Seat: seat, Created: time.Now(), GameReveal: reveal}
+	_, err := datastore.Put(c, revealKey, &value)
+	return err
+}
+
+func GetSeatReveals(c appengine.Context, game data.Game, seat int) ([]data.GameReveal, error) {
+	gameKey := makeGameKey(c, game)
+	q := datastore.NewQuery("SeatReveal").Ancestor(gameKey).Filter("Seat =", seat).Order("Created")
+	var values []seatReveal
+	_, err := q.GetAll(c, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	reveals := make([]data.GameReveal, len(values))
+	for i, value := range values {
+		reveals[i] = value.GameReveal
+	}
+	return reveals, nil
+}
+
+func StoreDecision(c appengine.Context, game data.Game, decision data.Decision) (*data.Decision, error) {
+	gameKey := makeGameKey(c, game)
+	var decisionKey *datastore.Key
+	if decision.Id == 0 {
+		decisionKey = datastore.NewIncompleteKey(c, "Decision", gameKey)
+	} else {
+		decisionKey = datastore.NewKey(c, "Decision", "", decision.Id, gameKey)
+	}
+	key, err := datastore.Put(c, decisionKey, &decision)
+	if err != nil {
+		return nil, err
+	}
+	decision.Id = key.IntID()
+	return &decision, nil
+}
+
+func GetDecision(c appengine.Context, game data.Game, id int64) (*data.Decision, error) {
+	gameKey := makeGameKey(c, game)
+	decisionKey := datastore.NewKey(c, "Decision", "", id, gameKey)
+	var decision data.Decision
+	err := datastore.Get(c, decisionKey, &decision)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	decision.Id = id
+	return &decision, err
+}
+
+func GetPendingDecisions(c appengine.Context, game data.Game, seat int) ([]data.Decision, error) {
+	gameKey := makeGameKey(c, game)
+	q := datastore.NewQuery("Decision").Ancestor(gameKey).Filter("Seat =", seat).Filter("Resolved =", false)
+	var decisions []data.Decision
+	keys, err := q.GetAll(c, &decisions)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		decisions[i].Id = key.IntID()
+	}
+	return decisions, nil
+}
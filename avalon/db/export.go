@@ -0,0 +1,118 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+	"time"
+)
+
+// This exports everything stored under a game. Rather than looking up
+// the entities the game state says should be there, it queries for
+// each kind, so that it also picks up anything left over from a game
+// which went wrong. It reads straight from the datastore.
+func ExportGame(c appengine.Context, game data.Game) (*data.GameExport, error) {
+	gameKey := makeGameKey(c, game)
+
+	gameStateKey := makeGameStateKey(c, game)
+	var state data.GameState
+	err := datastore.Get(c, gameStateKey, &state)
+	if err != nil {
+		return nil, err
+	}
+	game.State = &state
+	migrateGameState(game, &state)
+
+	export := data.GameExport{
+		FormatVersion: data.ExportFormatVersion,
+		DataVersion: CurrentDataVersion(),
+		Exported: time.Now(),
+		Game: game.GameStatic,
+		State: state,
+		PlayerIDs: make([]string, len(game.Roles)),
+	}
+
+	var playerids []StringStore
+	keys, err := datastore.NewQuery("PlayerID").Ancestor(gameKey).GetAll(c, &playerids)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		pos := int(key.IntID() - 1000)
+		if pos < 0 {
+			continue
+		}
+		for pos >= len(export.PlayerIDs) {
+			export.PlayerIDs = append(export.PlayerIDs, "")
+		}
+		export.PlayerIDs[pos] = playerids[i].Value
+	}
+
+	var proposals []data.Proposal
+	keys, err = datastore.NewQuery("Proposal").Ancestor(gameKey).GetAll(c, &proposals)
+	if err != nil {
+		return nil, err
+	}
+	export.Proposals = make([]data.ProposalExport, len(keys))
+	for i, key := range keys {
+		m := int(key.Parent().IntID() - 1000)
+		p := int(key.IntID() - 1000)
+		migrateProposal(game, m, p, &proposals[i])
+		export.Proposals[i] = data.ProposalExport{Mission: m, Proposal: p, Value: proposals[i]}
+	}
+
+	var actions []data.Actions
+	keys, err = datastore.NewQuery("Actions").Ancestor(gameKey).GetAll(c, &actions)
+	if err != nil {
+		return nil, err
+	}
+	export.Actions = make([]data.ActionsExport, len(keys))
+	for i, key := range keys {
+		m := int(key.IntID() - 1000)
+		migrateActions(game, m, &actions[i])
+		export.Actions[i] = data.ActionsExport{Mission: m, Value: actions[i]}
+	}
+
+	export.VoteResults = []data.VoteResult{}
+	_, err = datastore.NewQuery("VoteResult").Ancestor(gameKey).GetAll(c, &export.VoteResults)
+	if err != nil {
+		return nil, err
+	}
+
+	export.MissionResults = []data.MissionResult{}
+	_, err = datastore.NewQuery("MissionResult").Ancestor(gameKey).GetAll(c, &export.MissionResults)
+	if err != nil {
+		return nil, err
+	}
+
+	var reveals []seatReveal
+	_, err = datastore.NewQuery("SeatReveal").Ancestor(gameKey).GetAll(c, &reveals)
+	if err != nil {
+		return nil, err
+	}
+	export.SeatReveals = make([]data.SeatRevealExport, len(reveals))
+	for i, reveal := range reveals {
+		export.SeatReveals[i] = data.SeatRevealExport{Seat: reveal.Seat, Created: reveal.Created, Reveal: reveal.GameReveal}
+	}
+
+	var decisions []data.Decision
+	keys, err = datastore.NewQuery("Decision").Ancestor(gameKey).GetAll(c, &decisions)
+	if err != nil {
+		return nil, err
+	}
+	export.Decisions = make([]data.DecisionExport, len(keys))
+	for i, key := range keys {
+		decision := decisions[i]
+		export.Decisions[i] = data.DecisionExport{
+			Id: key.IntID(),
+			Seat: decision.Seat,
+			Kind: decision.Kind,
+			Label: decision.Label,
+			Players: decision.Players,
+			Resolved: decision.Resolved,
+			Choice: decision.Choice,
+		}
+	}
+
+	return &export, nil
+}
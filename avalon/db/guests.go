@@ -0,0 +1,97 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+)
+
+func makeGuestKey(c appengine.Context, userid string) *datastore.Key {
+	return datastore.NewKey(c, "Guest", "guest", 0, makePlayerKey(c, userid))
+}
+
+func StoreGuest(c appengine.Context, guest data.Guest) error {
+	_, err := datastore.Put(c, makeGuestKey(c, guest.UserID), &guest)
+	return err
+}
+
+// This returns nil if there is no such guest
+func GetGuest(c appengine.Context, userid string) (*data.Guest, error) {
+	var guest data.Guest
+	err := datastore.Get(c, makeGuestKey(c, userid), &guest)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	return &guest, err
+}
+
+// These find everything which refers to a user by ID, so that a
+// guest's history can be moved to their account. They return keys
+// only; each entity is read again in its own transaction.
+func findWithUser(c appengine.Context, kind string, userid string) ([]*datastore.Key, error) {
+	q := datastore.NewQuery(kind).Filter("UserIDs =", userid).KeysOnly()
+	return q.GetAll(c, nil)
+}
+
+func GamesWithUser(c appengine.Context, userid string) ([]*datastore.Key, error) {
+	return findWithUser(c, "Game", userid)
+}
+
+func RoomsWithUser(c appengine.Context, userid string) ([]*datastore.Key, error) {
+	return findWithUser(c, "Hangout", userid)
+}
+
+func SeriesWithUser(c appengine.Context, userid string) ([]*datastore.Key, error) {
+	return findWithUser(c, "Series", userid)
+}
+
+func replaceUserID(userids []string, olduserid string, newuserid string) {
+	for i, userid := range userids {
+		if userid == olduserid {
+			userids[i] = newuserid
+		}
+	}
+}
+
+// This changes a user ID in a game, room or series, as returned by
+// the functions above. Call it in a transaction.
+func ReplaceUserID(c appengine.Context, key *datastore.Key, olduserid string, newuserid string) error {
+	switch key.Kind() {
+	case "Game":
+		var game data.GameStatic
+		err := datastore.Get(c, key, &game)
+		if err != nil {
+			return err
+		}
+		replaceUserID(game.UserIDs, olduserid, newuserid)
+		_, err = datastore.Put(c, key, &game)
+		if err != nil {
+			return err
+		}
+		return cacheDeleteObject(c, "GameStatic", gameStaticCacheKey(game.Room, game.Id))
+
+	case "Hangout":
+		var room data.Room
+		err := datastore.Get(c, key, &room)
+		if err != nil {
+			return err
+		}
+		replaceUserID(room.UserIDs, olduserid, newuserid)
+		if room.Owner == olduserid {
+			room.Owner = newuserid
+		}
+		_, err = datastore.Put(c, key, &room)
+		return err
+
+	case "Series":
+		var series data.Series
+		err := datastore.Get(c, key, &series)
+		if err != nil {
+			return err
+		}
+		replaceUserID(series.UserIDs, olduserid, newuserid)
+		_, err = datastore.Put(c, key, &series)
+		return err
+	}
+	return nil
+}
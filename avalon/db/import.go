@@ -0,0 +1,108 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+	"time"
+)
+
+// This stores an exported game under a new game ID in the given
+// room. The entities are written exactly as they are in the
+// export, so older ones are migrated when they are next loaded. It
+// does not touch memcache - the game is new, so nothing can be cached
+// for it - and the writes are all in one entity group, so it can be
+// run in a transaction.
+func ImportGame(c appengine.Context, room string, gameid string, export data.GameExport) (data.Game, error) {
+	game := data.Game{GameStatic: export.Game, State: &export.State}
+	game.Id = gameid
+	game.Room = room
+	// Starting it now makes it the current game in the room
+	game.StartTime = time.Now()
+	// The copy isn't part of the original's series
+	game.Series = ""
+	game.SeriesSeats = nil
+	fillCardOps(&game)
+
+	gameKey := makeGameKey(c, game)
+	_, err := datastore.Put(c, gameKey, &game.GameStatic)
+	if err != nil {
+		return game, err
+	}
+
+	_, err = datastore.Put(c, makeGameStateKey(c, game), game.State)
+	if err != nil {
+		return game, err
+	}
+
+	for pos, id := range export.PlayerIDs {
+		if id == "" {
+			continue
+		}
+		playerIDKey := datastore.NewKey(c, "PlayerID", "", int64(1000 + pos), gameKey)
+		_, err = datastore.Put(c, playerIDKey, &StringStore{id})
+		if err != nil {
+			return game, err
+		}
+	}
+
+	for _, proposal := range export.Proposals {
+		missionKey := datastore.NewKey(c, "Mission", "", int64(1000 + proposal.Mission), gameKey)
+		proposalKey := datastore.NewKey(c, "Proposal", "", int64(1000 + proposal.Proposal), missionKey)
+		_, err = datastore.Put(c, proposalKey, &proposal.Value)
+		if err != nil {
+			return game, err
+		}
+	}
+
+	for _, actions := range export.Actions {
+		actionsKey := datastore.NewKey(c, "Actions", "", int64(1000 + actions.Mission), gameKey)
+		_, err = datastore.Put(c, actionsKey, &actions.Value)
+		if err != nil {
+			return game, err
+		}
+	}
+
+	for _, result := range export.VoteResults {
+		voteResultKey := datastore.NewKey(c, "VoteResult", "", int64(1000 + result.Index), gameKey)
+		_, err = datastore.Put(c, voteResultKey, &result)
+		if err != nil {
+			return game, err
+		}
+	}
+
+	for _, result := range export.MissionResults {
+		missionKey := datastore.NewKey(c, "MissionResult", "", int64(1000 + result.Mission), gameKey)
+		_, err = datastore.Put(c, missionKey, &result)
+		if err != nil {
+			return game, err
+		}
+	}
+
+	for _, reveal := range export.SeatReveals {
+		revealKey := datastore.NewIncompleteKey(c, "SeatReveal", gameKey)
+		value := seatReveal{Seat: reveal.Seat, Created: reveal.Created, GameReveal: reveal.Reveal}
+		_, err = datastore.Put(c, revealKey, &value)
+		if err != nil {
+			return game, err
+		}
+	}
+
+	for _, decision := range export.Decisions {
+		decisionKey := datastore.NewKey(c, "Decision", "", decision.Id, gameKey)
+		value := data.Decision{
+			Seat: decision.Seat,
+			Kind: decision.Kind,
+			Label: decision.Label,
+			Players: decision.Players,
+			Resolved: decision.Resolved,
+			Choice: decision.Choice,
+		}
+		_, err = datastore.Put(c, decisionKey, &value)
+		if err != nil {
+			return game, err
+		}
+	}
+
+	return game, nil
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+	"strconv"
+)
+
+// A Migration brings stored entities from DataVersion Version-1 up to
+// Version. Each of GameState, Proposal and Actions carries its own
+// DataVersion, since they are written at different times, and the
+// functions here are applied to each entity as it is loaded - they
+// only change the loaded copy, which is written back the next time
+// the game stores it (or by MigrateGame). Any of them may be nil if
+// the migration does not touch that kind of entity.
+//
+// Fields which a migration moves data out of have to stay in the
+// structs in data until no stored entity can be older than that
+// migration.
+type Migration struct {
+	Version int
+	Description string
+	GameState func(game data.Game, state *data.GameState)
+	Proposal func(game data.Game, m int, p int, proposal *data.Proposal)
+	Actions func(game data.Game, m int, actions *data.Actions)
+}
+
+// Entities stored before DataVersion existed load as version 0, which
+// is the same shape as version 1
+var migrations []Migration
+
+func AddMigration(migration Migration) {
+	if migration.Version != CurrentDataVersion() + 1 {
+		panic("Migration " + strconv.Itoa(migration.Version) + " is out of order")
+	}
+	migrations = append(migrations, migration)
+}
+
+// This returns the DataVersion that newly stored entities have
+func CurrentDataVersion() int {
+	return len(migrations) + 1
+}
+
+func GetMigrations() []Migration {
+	return migrations
+}
+
+func init() {
+	AddMigration(Migration{
+		Version: 2,
+		Description: "Mark everybody as having voted on the fifth proposal",
+		Proposal: func(game data.Game, m int, p int, proposal *data.Proposal) {
+			// The fifth proposal was stored with its votes set but
+			// Voted left empty, so it never looked approved
+			if p != 4 {
+				return
+			}
+			for i := range proposal.Voted {
+				proposal.Voted[i] = true
+			}
+		},
+	})
+}
+
+// Each of these returns true if the entity was older than the current
+// version
+
+func migrateGameState(game data.Game, state *data.GameState) bool {
+	if state.DataVersion >= CurrentDataVersion() {
+		return false
+	}
+	for _, migration := range migrations {
+		if migration.Version > state.DataVersion && migration.GameState != nil {
+			migration.GameState(game, state)
+		}
+	}
+	state.DataVersion = CurrentDataVersion()
+	return true
+}
+
+func migrateProposal(game data.Game, m int, p int, proposal *data.Proposal) bool {
+	if proposal.DataVersion >= CurrentDataVersion() {
+		return false
+	}
+	for _, migration := range migrations {
+		if migration.Version > proposal.DataVersion && migration.Proposal != nil {
+			migration.Proposal(game, m, p, proposal)
+		}
+	}
+	proposal.DataVersion = CurrentDataVersion()
+	return true
+}
+
+func migrateActions(game data.Game, m int, actions *data.Actions) bool {
+	if actions.DataVersion >= CurrentDataVersion() {
+		return false
+	}
+	for _, migration := range migrations {
+		if migration.Version > actions.DataVersion && migration.Actions != nil {
+			migration.Actions(game, m, actions)
+		}
+	}
+	actions.DataVersion = CurrentDataVersion()
+	return true
+}
+
+// This brings every stored entity of a game up to the current
+// version, returning the oldest version found and the number of
+// entities which were old. With dryRun set nothing is written. It
+// reads straight from the datastore and does not touch memcache, so it
+// should be run inside a game transaction.
+func MigrateGame(c appengine.Context, game data.Game, dryRun bool) (int, int, error) {
+	oldest := CurrentDataVersion()
+	count := 0
+	note := func(version int) {
+		if version < oldest {
+			oldest = version
+		}
+		count++
+	}
+
+	gameStateKey := makeGameStateKey(c, game)
+	var state data.GameState
+	err := datastore.Get(c, gameStateKey, &state)
+	if err != nil {
+		return oldest, count, err
+	}
+	game.State = &state
+	version := state.DataVersion
+	if migrateGameState(game, &state) {
+		note(version)
+		if !dryRun {
+			_, err = datastore.Put(c, gameStateKey, &state)
+			if err != nil {
+				return oldest, count, err
+			}
+		}
+	}
+
+	gameKey := makeGameKey(c, game)
+	for m := 0; m < len(game.Setup.Missions); m++ {
+		missionKey := datastore.NewKey(c, "Mission", "", int64(1000 + m), gameKey)
+		for p := 0; p < 5; p++ {
+			proposalKey := datastore.NewKey(c, "Proposal", "", int64(1000 + p), missionKey)
+			var proposal data.Proposal
+			err := datastore.Get(c, proposalKey, &proposal)
+			if err == datastore.ErrNoSuchEntity {
+				continue
+			} else if err != nil {
+				return oldest, count, err
+			}
+			version := proposal.DataVersion
+			if migrateProposal(game, m, p, &proposal) {
+				note(version)
+				if !dryRun {
+					_, err = datastore.Put(c, proposalKey, &proposal)
+					if err != nil {
+						return oldest, count, err
+					}
+				}
+			}
+		}
+
+		actionsKey := datastore.NewKey(c, "Actions", "", int64(1000 + m), gameKey)
+		var actions data.Actions
+		err := datastore.Get(c, actionsKey, &actions)
+		if err == datastore.ErrNoSuchEntity {
+			continue
+		} else if err != nil {
+			return oldest, count, err
+		}
+		version := actions.DataVersion
+		if migrateActions(game, m, &actions) {
+			note(version)
+			if !dryRun {
+				_, err = datastore.Put(c, actionsKey, &actions)
+				if err != nil {
+					return oldest, count, err
+				}
+			}
+		}
+	}
+
+	return oldest, count, nil
+}
+
+// This returns up to limit games in the order they were created,
+// starting from cursor (or the beginning if it is empty), and the
+// cursor to continue from
+func GamesFrom(c appengine.Context, cursor string, limit int) ([]data.Game, string, error) {
+	q := datastore.NewQuery("Game").Order("StartTime").Limit(limit)
+	if cursor != "" {
+		start, err := datastore.DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		q = q.Start(start)
+	}
+
+	games := []data.Game{}
+	iter := q.Run(c)
+	for {
+		var gamestatic data.GameStatic
+		_, err := iter.Next(&gamestatic)
+		if err == datastore.Done {
+			break
+		} else if err != nil {
+			return nil, "", err
+		}
+		game := data.Game{GameStatic: gamestatic}
+		fillCardOps(&game)
+		games = append(games, game)
+	}
+
+	next, err := iter.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return games, next.String(), nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+)
+
+// Everything kept per player (their ratings and achievements) is in
+// one entity group, so updating the players of a game needs a
+// cross-group transaction with one group per player
+func makePlayerKey(c appengine.Context, userid string) *datastore.Key {
+	return datastore.NewKey(c, "Player", userid, 0, nil)
+}
+
+// A player's ratings are keyed by scope: "global", or the room
+func makeRatingKey(c appengine.Context, scope string, userid string) *datastore.Key {
+	if scope == "" {
+		return datastore.NewKey(c, "Rating", "global", 0, makePlayerKey(c, userid))
+	}
+	return datastore.NewKey(c, "Rating", "room/" + scope, 0, makePlayerKey(c, userid))
+}
+
+// This returns all of a player's ratings, the global one first if
+// there is one
+func GetPlayerRatings(c appengine.Context, userid string) ([]data.Rating, error) {
+	q := datastore.NewQuery("Rating").Ancestor(makePlayerKey(c, userid))
+	var ratings []data.Rating
+	_, err := q.GetAll(c, &ratings)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := []data.Rating{}
+	for _, rating := range ratings {
+		if rating.Scope == "" {
+			sorted = append(sorted, rating)
+		}
+	}
+	for _, rating := range ratings {
+		if rating.Scope != "" {
+			sorted = append(sorted, rating)
+		}
+	}
+	return sorted, nil
+}
+
+// This returns nil if the player has no rating in this scope yet
+func GetRating(c appengine.Context, scope string, userid string) (*data.Rating, error) {
+	var rating data.Rating
+	err := datastore.Get(c, makeRatingKey(c, scope, userid), &rating)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	return &rating, err
+}
+
+func StoreRating(c appengine.Context, rating data.Rating) error {
+	_, err := datastore.Put(c, makeRatingKey(c, rating.Scope, rating.UserID), &rating)
+	return err
+}
+
+func DeleteRating(c appengine.Context, rating data.Rating) error {
+	return datastore.Delete(c, makeRatingKey(c, rating.Scope, rating.UserID))
+}
+
+// This returns up to limit ratings in scope, best first by the given
+// property ("Good", "Evil" or "Overall"), leaving out players who
+// haven't played that side, and guests unless includeGuests is set
+func GetLeaderboard(c appengine.Context, scope string, property string, includeGuests bool, limit int) ([]data.Rating, error) {
+	q := datastore.NewQuery("Rating").Filter("Scope =", scope).Order("-" + property)
+	ratings := []data.Rating{}
+	iter := q.Run(c)
+	for len(ratings) < limit {
+		var rating data.Rating
+		_, err := iter.Next(&rating)
+		if err == datastore.Done {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if (property == "Good" && rating.GoodGames == 0) || (property == "Evil" && rating.EvilGames == 0) {
+			continue
+		}
+		if rating.Guest && !includeGuests {
+			continue
+		}
+		ratings = append(ratings, rating)
+	}
+	return ratings, nil
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+)
+
+// A game has at most one rematch, which lives under it
+func makeRematchKey(c appengine.Context, game data.Game) *datastore.Key {
+	return datastore.NewKey(c, "Rematch", "", 1, makeGameKey(c, game))
+}
+
+func StoreRematch(c appengine.Context, game data.Game, rematch data.Rematch) error {
+	_, err := datastore.Put(c, makeRematchKey(c, game), &rematch)
+	return err
+}
+
+// This returns nil if nobody has asked for a rematch of the game
+func GetRematch(c appengine.Context, game data.Game) (*data.Rematch, error) {
+	var rematch data.Rematch
+	err := datastore.Get(c, makeRematchKey(c, game), &rematch)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	return &rematch, err
+}
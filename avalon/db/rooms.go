@@ -0,0 +1,44 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+)
+
+// Rooms are the roots of the entity groups which hold games. The kind
+// is still "Hangout", from when every room was a hangout, so that the
+// games played in hangouts stay where they are.
+func makeRoomKey(c appengine.Context, id string) *datastore.Key {
+	return datastore.NewKey(c, "Hangout", id, 0, nil)
+}
+
+func StoreRoom(c appengine.Context, room data.Room) error {
+	_, err := datastore.Put(c, makeRoomKey(c, room.Id), &room)
+	return err
+}
+
+// This returns nil if there is no such room, which includes rooms in
+// hangouts
+func GetRoom(c appengine.Context, id string) (*data.Room, error) {
+	var room data.Room
+	err := datastore.Get(c, makeRoomKey(c, id), &room)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	return &room, err
+}
+
+// This returns nil if no room has the code
+func FindRoomByCode(c appengine.Context, code string) (*data.Room, error) {
+	q := datastore.NewQuery("Hangout").Filter("Code =", code).Limit(1)
+	var rooms []data.Room
+	_, err := q.GetAll(c, &rooms)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return nil, nil
+	}
+	return &rooms[0], nil
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+)
+
+// A series lives in its room's entity group, so it can be updated
+// in the same transaction as its games
+func makeSeriesKey(c appengine.Context, room string, id string) *datastore.Key {
+	roomKey := makeRoomKey(c, room)
+	return datastore.NewKey(c, "Series", id, 0, roomKey)
+}
+
+func StoreSeries(c appengine.Context, series data.Series) error {
+	_, err := datastore.Put(c, makeSeriesKey(c, series.Room, series.Id), &series)
+	return err
+}
+
+// This returns nil if there is no such series
+func GetSeries(c appengine.Context, room string, id string) (*data.Series, error) {
+	var series data.Series
+	err := datastore.Get(c, makeSeriesKey(c, room, id), &series)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	return &series, err
+}
+
+// This returns the most recently started series in a room, or nil
+// if there has never been one
+func CurrentSeries(c appengine.Context, room string) (*data.Series, error) {
+	roomKey := makeRoomKey(c, room)
+	q := datastore.NewQuery("Series").Ancestor(roomKey).Order("-Created").Limit(1)
+	var series []data.Series
+	_, err := q.GetAll(c, &series)
+	if err != nil {
+		return nil, err
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+	return &series[0], nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"time"
+)
+
+// A StoredSession is a session kept on the server. Values is the
+// session's values, gob encoded.
+type StoredSession struct {
+	Values []byte
+	Expires time.Time
+}
+
+func makeSessionKey(c appengine.Context, id string) *datastore.Key {
+	return datastore.NewKey(c, "Session", id, 0, nil)
+}
+
+func sessionCacheKey(id string) string {
+	return makeCacheKey("session", id)
+}
+
+func StoreSession(c appengine.Context, id string, session StoredSession) error {
+	_, err := datastore.Put(c, makeSessionKey(c, id), &session)
+	if err != nil {
+		return err
+	}
+	cacheSetObject(c, "session", sessionCacheKey(id), 600, session)
+	return nil
+}
+
+// This returns nil if there is no such session, or it has expired
+func GetSession(c appengine.Context, id string) (*StoredSession, error) {
+	var session StoredSession
+	ok := cacheGetObject(c, "session", sessionCacheKey(id), &session)
+	if !ok {
+		err := datastore.Get(c, makeSessionKey(c, id), &session)
+		if err == datastore.ErrNoSuchEntity {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if session.Expires.Before(time.Now()) {
+		return nil, DeleteSession(c, id)
+	}
+	return &session, nil
+}
+
+// This deletes up to limit sessions that have expired, and returns how
+// many it deleted
+func DeleteExpiredSessions(c appengine.Context, limit int) (int, error) {
+	q := datastore.NewQuery("Session").Filter("Expires <", time.Now()).KeysOnly().Limit(limit)
+	keys, err := q.GetAll(c, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), datastore.DeleteMulti(c, keys)
+}
+
+func DeleteSession(c appengine.Context, id string) error {
+	err := cacheDeleteObject(c, "session", sessionCacheKey(id))
+	if err != nil {
+		return err
+	}
+	return datastore.Delete(c, makeSessionKey(c, id))
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+)
+
+// All the card stats share one entity group, so that each game is
+// added to every row in one transaction, along with a marker which
+// stops it being added twice. Games are added by a task after they
+// end (see stats.RecordGame), so two games ending together only
+// contend in their tasks, which are retried.
+func makeCardStatsRootKey(c appengine.Context) *datastore.Key {
+	return datastore.NewKey(c, "StatsRoot", "cards", 0, nil)
+}
+
+func makeCardStatKey(c appengine.Context, table string, key string) *datastore.Key {
+	return datastore.NewKey(c, "CardStat", table + "/" + key, 0, makeCardStatsRootKey(c))
+}
+
+// This returns a zero row if there isn't one stored yet
+func GetCardStat(c appengine.Context, table string, key string) (data.CardStat, error) {
+	stat := data.CardStat{Table: table, Key: key}
+	err := datastore.Get(c, makeCardStatKey(c, table, key), &stat)
+	if err == datastore.ErrNoSuchEntity {
+		return stat, nil
+	}
+	return stat, err
+}
+
+func StoreCardStat(c appengine.Context, stat data.CardStat) error {
+	_, err := datastore.Put(c, makeCardStatKey(c, stat.Table, stat.Key), &stat)
+	return err
+}
+
+func GetCardStats(c appengine.Context) ([]data.CardStat, error) {
+	q := datastore.NewQuery("CardStat").Ancestor(makeCardStatsRootKey(c))
+	stats := []data.CardStat{}
+	_, err := q.GetAll(c, &stats)
+	return stats, err
+}
+
+func makeCardStatGameKey(c appengine.Context, roomid string, gameid string) *datastore.Key {
+	return datastore.NewKey(c, "CardStatGame", roomid + "/" + gameid, 0, makeCardStatsRootKey(c))
+}
+
+// This is true if the game has already been added to the card stats
+func CardStatsHaveGame(c appengine.Context, roomid string, gameid string) (bool, error) {
+	var marker data.CardStatGame
+	err := datastore.Get(c, makeCardStatGameKey(c, roomid, gameid), &marker)
+	if err == datastore.ErrNoSuchEntity {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func StoreCardStatGame(c appengine.Context, roomid string, gameid string, marker data.CardStatGame) error {
+	_, err := datastore.Put(c, makeCardStatGameKey(c, roomid, gameid), &marker)
+	return err
+}
@@ -8,6 +8,10 @@ import (
 	"avalon/web"
 )
 
+// Game transactions are cross-group, since finishing a game also
+// updates the players' ratings and the card stats
+var gameTransactionOptions = &datastore.TransactionOptions{XG: true}
+
 type GameTransaction func(c appengine.Context, game data.Game) (*web.AppError)
 
 func RunGameTransaction(c appengine.Context, game *data.Game, trans GameTransaction) *web.AppError {
@@ -16,7 +20,7 @@ func RunGameTransaction(c appengine.Context, game *data.Game, trans GameTransact
 	}
 	var aerr *web.AppError
 	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
-		terr := db.EnsureGameState(c, game, true)
+		terr := db.EnsureGameState(tc, game, true)
 		if terr != nil {
 			return terr
 		}
@@ -26,7 +30,7 @@ func RunGameTransaction(c appengine.Context, game *data.Game, trans GameTransact
 			return aerr.Err
 		}
 		return nil
-	}, nil)
+	}, gameTransactionOptions)
 	if aerr != nil {
 		return aerr
 	}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+	"strings"
+)
+
+// Usernames are case insensitive
+func makePasswordUserKey(c appengine.Context, username string) *datastore.Key {
+	return datastore.NewKey(c, "PasswordUser", strings.ToLower(username), 0, nil)
+}
+
+func StorePasswordUser(c appengine.Context, user data.PasswordUser) error {
+	_, err := datastore.Put(c, makePasswordUserKey(c, user.Username), &user)
+	return err
+}
+
+// This returns nil if there is no such user
+func GetPasswordUser(c appengine.Context, username string) (*data.PasswordUser, error) {
+	var user data.PasswordUser
+	err := datastore.Get(c, makePasswordUserKey(c, username), &user)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	return &user, err
+}
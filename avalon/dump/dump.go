@@ -36,10 +36,10 @@ var recentGamesTemplate = template.Must(template.ParseFiles("template/recentgame
 var dumpGameTemplate = template.Must(template.ParseFiles("template/dumpgame.html"))
 
 func ReqDumpGame(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
-	hangout := r.FormValue("hangout")
+	room := r.FormValue("room")
 	gameid := r.FormValue("game")
 
-	if hangout == "" || gameid == "" {
+	if room == "" || gameid == "" {
 		games, err := db.RecentGames(c, 20)
 		if err != nil {
 			return &web.AppError{err, "Could not retrieve recent games", 500}
@@ -53,7 +53,7 @@ func ReqDumpGame(w http.ResponseWriter, r *http.Request, c appengine.Context, se
 		return nil
 	}
 
-	pgame, err := db.RetrieveGame(c, hangout, gameid)
+	pgame, err := db.RetrieveGame(c, room, gameid)
 	if err != nil {
 		return &web.AppError{err, "Could not retrieve game", 500}
 	}
@@ -61,24 +61,41 @@ func ReqDumpGame(w http.ResponseWriter, r *http.Request, c appengine.Context, se
 		m := "Could not find game"
 		return &web.AppError{errors.New(m), m, 404}
 	}
-	err = db.EnsureGameState(c, pgame, true)
+	export, err := db.ExportGame(c, *pgame)
 	if err != nil {
-		return &web.AppError{err, "Could not retrieve game state", 500}
+		return &web.AppError{err, "Could not export game", 500}
 	}
 	game := *pgame
+	game.State = &export.State
 
-	missions := make([]DumpMission, 5)
-	for m := 0; m < 5; m++ {
-		missions[m].Proposals = make([]DumpProposal, 5)
-		missions[m].Actions, _ = db.GetActions(c, true, game, m)
-		for p := 0; p < 5; p++ {
-			missions[m].Proposals[p].Proposal, _ = db.GetProposal(c, true, game, m, p)
+	// Only show the missions and proposals which actually exist
+	missions := []DumpMission{}
+	grow := func(m int) {
+		for len(missions) <= m {
+			missions = append(missions, DumpMission{Proposals: []DumpProposal{}})
 		}
 	}
+	for i := range export.Proposals {
+		proposal := &export.Proposals[i]
+		grow(proposal.Mission)
+		for len(missions[proposal.Mission].Proposals) <= proposal.Proposal {
+			missions[proposal.Mission].Proposals = append(missions[proposal.Mission].Proposals, DumpProposal{})
+		}
+		missions[proposal.Mission].Proposals[proposal.Proposal].Proposal = &proposal.Value
+	}
+	for i := range export.Actions {
+		actions := &export.Actions[i]
+		grow(actions.Mission)
+		missions[actions.Mission].Actions = &actions.Value
+	}
+
+	missionresults := make([]*data.MissionResult, len(export.MissionResults))
+	for i := range export.MissionResults {
+		missionresults[i] = &export.MissionResults[i]
+	}
 
-	playerids, _ := db.GetPlayerIDs(c, game)
-	missionresults, _ := db.GetMissionResults(c, game)
-	voteresults, _ := db.GetVoteResults(c, game)
+	playerids := export.PlayerIDs
+	voteresults := export.VoteResults
 
 	dump := DumpGameData{
 		Game: game,
@@ -0,0 +1,50 @@
+package dump
+
+import (
+	"appengine"
+	"avalon/db"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"net/http"
+)
+
+func init() {
+	http.Handle("/admin/export", web.AppHandler(ReqExportGame))
+}
+
+// This returns a whole game as one JSON document, suitable for
+// attaching to a bug report
+func ReqExportGame(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	room := r.FormValue("room")
+	gameid := r.FormValue("game")
+
+	if room == "" || gameid == "" {
+		m := "Need both room and game"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	pgame, err := db.RetrieveGame(c, room, gameid)
+	if err != nil {
+		return &web.AppError{err, "Could not retrieve game", 500}
+	}
+	if pgame == nil {
+		m := "Could not find game"
+		return &web.AppError{errors.New(m), m, 404}
+	}
+
+	export, err := db.ExportGame(c, *pgame)
+	if err != nil {
+		return &web.AppError{err, "Could not export game", 500}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"avalon-" + gameid + ".json\"")
+	err = json.NewEncoder(w).Encode(export)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
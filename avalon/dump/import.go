@@ -0,0 +1,153 @@
+package dump
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/data"
+	"avalon/data/cards"
+	"avalon/db"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"strconv"
+)
+
+func init() {
+	http.Handle("/admin/import", web.AppHandler(ReqImportGame))
+}
+
+type ImportResponse struct {
+	Room string `json:"room"`
+	Game string `json:"game"`
+	// The events which were imported
+	Events []data.ExportEvent `json:"events"`
+}
+
+func ValidateImport(export data.GameExport) *web.AppError {
+	// Version 1 is the same apart from the game's room, which was
+	// called Hangout
+	if export.FormatVersion < 1 || export.FormatVersion > data.ExportFormatVersion {
+		m := "Unsupported export format " + strconv.Itoa(export.FormatVersion)
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	if export.DataVersion > db.CurrentDataVersion() {
+		m := "Export is from a newer version of the game"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	seats := len(export.Game.Setup.Cards)
+	if len(export.Game.Roles) != seats {
+		m := "Export has a different number of roles and cards"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	if len(export.Game.UserIDs) != seats || len(export.PlayerIDs) != seats {
+		m := "Export has a different number of players and cards"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	// Each seat has a different card
+	used := make([]bool, seats)
+	for _, role := range export.Game.Roles {
+		if role < 0 || role >= seats || used[role] {
+			m := "Invalid role " + strconv.Itoa(role)
+			return &web.AppError{errors.New(m), m, 400}
+		}
+		used[role] = true
+	}
+
+	for _, label := range export.Game.Setup.Cards {
+		if _, ok := cards.CardFactory[label]; !ok {
+			m := "Invalid card " + label
+			return &web.AppError{errors.New(m), m, 400}
+		}
+	}
+
+	return nil
+}
+
+// This loads a game from /admin/export under a new game ID. The game
+// goes in the room given, or the one it was exported from, and
+// becomes the current game there. With truncate=N it is cut off
+// straight after event N (see data.GameExport.Events).
+func ReqImportGame(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	if r.Method != "POST" {
+		m := "Importing needs a POST"
+		return &web.AppError{errors.New(m), m, 405}
+	}
+
+	var export data.GameExport
+	err := json.NewDecoder(r.Body).Decode(&export)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	aerr := ValidateImport(export)
+	if aerr != nil {
+		return aerr
+	}
+
+	if r.FormValue("truncate") != "" {
+		event, err := strconv.Atoi(r.FormValue("truncate"))
+		if err != nil {
+			return &web.AppError{err, "Invalid event to truncate at", 400}
+		}
+
+		// Whether there is an assassination depends on Merlin as well
+		// as the assassin, so ask the game
+		game := data.Game{GameStatic: export.Game}
+		game.Cards = make([]data.CardOps, len(game.Setup.Cards))
+		for i, label := range game.Setup.Cards {
+			game.Cards[i] = cards.CardFactory[label]()
+		}
+
+		export, err = export.Truncate(event, game.FindAssassin() != -1)
+		if err != nil {
+			return &web.AppError{err, err.Error(), 400}
+		}
+	}
+
+	room := r.FormValue("room")
+	if room == "" {
+		room = export.Game.Room
+	}
+	if room == "" {
+		m := "Need a room to put the game in"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	var gameid string
+	for {
+		gameid = data.RandomString(64)
+		oldgame, err := db.RetrieveGameStatic(c, room, gameid)
+		if err != nil {
+			return &web.AppError{err, "Error checking game ID", 500}
+		}
+		if oldgame == nil {
+			break
+		}
+	}
+
+	err = datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		_, err := db.ImportGame(tc, room, gameid, export)
+		return err
+	}, nil)
+	if err != nil {
+		return &web.AppError{err, "Error storing imported game", 500}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(ImportResponse{
+		Room: room,
+		Game: gameid,
+		Events: export.Events(),
+	})
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package gameplay
+
+import (
+	"appengine"
+	"avalon/achievements"
+	"avalon/data"
+	"avalon/db"
+	"avalon/db/trans"
+	"avalon/ratings"
+	"avalon/series"
+	"avalon/stats"
+	"avalon/web"
+)
+
+// A Move is the state of play that a Command is checked against
+type Move struct {
+	Game data.Game
+	// These are nil if there is no current proposal or mission
+	Proposal *data.Proposal
+	Actions *data.Actions
+}
+
+// Every move a seat makes, from a player or from the AI, is a
+// Command. Commands are only ever run through RunCommand (or execute,
+// from inside a transaction that is already running), which validates
+// them against the state loaded in the same transaction that applies
+// them.
+type Command interface {
+	// This returns an error if the command is not legal right now.
+	// It may read from the datastore, but must not write to it.
+	Validate(c appengine.Context, move Move, mypos int) *web.AppError
+	// This makes the move. It is only called after Validate passes.
+	Apply(c appengine.Context, move Move, mypos int) *web.AppError
+}
+
+// This loads the current proposal and actions for a game. It reads
+// the datastore, so inside a transaction it will not see anything
+// written earlier in that transaction - code which is part way
+// through a move must build the Move itself.
+func load_move(c appengine.Context, game data.Game) (Move, *web.AppError) {
+	move := Move{Game: game}
+
+	if game.State.HaveProposal {
+		proposal, err := db.GetProposal(c, true, game, game.State.ThisMission, game.State.ThisProposal)
+		if err != nil {
+			return move, &web.AppError{err, "Error retrieving proposal", 500}
+		}
+		move.Proposal = proposal
+	}
+
+	if game.State.HaveActions {
+		actions, err := db.GetActions(c, true, game, game.State.ThisMission)
+		if err != nil {
+			return move, &web.AppError{err, "Error retrieving actions", 500}
+		}
+		move.Actions = actions
+	}
+
+	return move, nil
+}
+
+func execute(c appengine.Context, move Move, mypos int, cmd Command) *web.AppError {
+	aerr := cmd.Validate(c, move, mypos)
+	if aerr != nil {
+		return aerr
+	}
+	return cmd.Apply(c, move, mypos)
+}
+
+// This runs a command for the seat mypos in a game transaction. If
+// the command ends the game, the players' ratings and the game's
+// series are updated in the same transaction, and the card stats and
+// achievements by tasks it adds.
+func RunCommand(c appengine.Context, game *data.Game, mypos int, cmd Command) *web.AppError {
+	return trans.RunGameTransaction(c, game, func(tc appengine.Context, game data.Game) *web.AppError {
+		move, aerr := load_move(tc, game)
+		if aerr != nil {
+			return aerr
+		}
+
+		wasOver := game.State.GameOver
+		aerr = execute(tc, move, mypos, cmd)
+		if aerr != nil {
+			return aerr
+		}
+
+		if game.State.GameOver && !wasOver {
+			err := ratings.RateGame(tc, game)
+			if err != nil {
+				return &web.AppError{err, "Error updating ratings", 500}
+			}
+			err = stats.RecordGame(tc, game)
+			if err != nil {
+				return &web.AppError{err, "Error updating card stats", 500}
+			}
+			err = series.RecordGame(tc, game)
+			if err != nil {
+				return &web.AppError{err, "Error updating series", 500}
+			}
+			err = achievements.RecordGame(tc, game)
+			if err != nil {
+				return &web.AppError{err, "Error awarding achievements", 500}
+			}
+		}
+		return nil
+	})
+}
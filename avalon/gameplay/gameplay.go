@@ -2,13 +2,12 @@ package gameplay
 
 import (
 	"appengine"
+	"avalon/api"
 	"avalon/data"
 	"avalon/db"
 	"avalon/gameplay/state"
-	"avalon/db/trans"
 	"avalon/web"
 	"encoding/json"
-	"errors"
 	"github.com/gorilla/sessions"
 	"net/http"
 	mathrand "math/rand"
@@ -20,6 +19,7 @@ func init() {
 	http.Handle("/game/mission", web.GameHandler(ReqGameMission))
 	http.Handle("/game/assassin", web.GameHandler(ReqGameAssassin))
 	http.Handle("/game/poke", web.GameHandler(ReqGamePoke))
+	http.Handle("/game/decide", web.GameHandler(ReqGameDecide))
 }
 
 func count_score(results []*data.MissionResult) (int, int) {
@@ -39,11 +39,20 @@ func count_score(results []*data.MissionResult) (int, int) {
 	return good, evil
 }
 
+// The AI makes its moves as commands, the same as players do. These
+// are called part way through a transaction, so they build the Move
+// from the proposal and actions being worked on.
+
 func ai_votes(c appengine.Context, game data.Game, proposal *data.Proposal) *web.AppError {
 	for _, i := range game.AIs {
-		vote := mathrand.Intn(2) == 1
+		vote := "reject"
+		if mathrand.Intn(2) == 1 {
+			vote = "approve"
+		}
 		//log.Printf("AI %s vote: %v", game.Players[i], vote)
-		aerr := do_vote(c, game, i, vote, proposal)
+		move := Move{Game: game, Proposal: proposal}
+		votedata := VoteData{Mission: game.State.ThisMission, Proposal: game.State.ThisProposal, Vote: vote}
+		aerr := execute(c, move, i, &votedata)
 		if aerr != nil {
 			return aerr
 		}
@@ -64,9 +73,10 @@ func ai_actions(c appengine.Context, game data.Game, proposal data.Proposal, act
 			//card := game.Cards[role]
 			//permitted := card.PermittedActions(game, proposal)
 			//action := !permitted["Failure"]
-			action := true
 			//log.Printf("AI %s action: %v", game.Players[i], action)
-			aerr := do_action(c, game, i, action, proposal, actions)
+			move := Move{Game: game, Proposal: &proposal, Actions: actions}
+			actiondata := ActionData{Mission: game.State.ThisMission, Proposal: game.State.ThisProposal, Action: "Success"}
+			aerr := execute(c, move, i, &actiondata)
 			if aerr != nil {
 				return aerr
 			}
@@ -91,7 +101,8 @@ func ai_proposal(c appengine.Context, game data.Game) *web.AppError {
 				players[j+1] = pos
 			}
 			//log.Printf("AI %s proposing: %v", game.Players[i], players)
-			aerr := do_proposal(c, game, players)
+			proposedata := ProposeData{Mission: game.State.ThisMission, Proposal: game.State.ThisProposal, Players: players}
+			aerr := execute(c, Move{Game: game}, i, &proposedata)
 			if aerr != nil {
 				return aerr
 			}
@@ -106,10 +117,11 @@ func ai_assassinate(c appengine.Context, game data.Game) *web.AppError {
 	for _, i := range game.AIs {
 		if i == assassin {
 			// Crude way to find a good player
-			order := mathrand.Perm(len(game.Roles) - 1)
+			order := mathrand.Perm(len(game.Roles))
 			for _, j := range order {
-				if !game.Cards[game.Roles[j]].AllocatedAsSpy() {
-					aerr := do_assassin(c, game, j)
+				if j != i && !game.Cards[game.Roles[j]].AllocatedAsSpy() {
+					assassindata := AssassinData{Target: j}
+					aerr := execute(c, Move{Game: game}, i, &assassindata)
 					if aerr != nil {
 						return aerr
 					}
@@ -121,6 +133,41 @@ func ai_assassinate(c appengine.Context, game data.Game) *web.AppError {
 	return nil
 }
 
+func store_phase_result(c appengine.Context, game data.Game, seat int, result data.PhaseResult) *web.AppError {
+	for _, reveal := range result.Reveals {
+		err := db.StoreSeatReveal(c, game, seat, reveal)
+		if err != nil {
+			return &web.AppError{err, "Error storing seat reveal", 500}
+		}
+	}
+
+	for _, decision := range result.Decisions {
+		decision.Seat = seat
+		_, err := db.StoreDecision(c, game, decision)
+		if err != nil {
+			return &web.AppError{err, "Error storing decision", 500}
+		}
+	}
+
+	return nil
+}
+
+// This stores what the phase hooks produced for each seat
+func store_phase_results(c appengine.Context, game data.Game, results []data.PhaseResult) *web.AppError {
+	for seat, result := range results {
+		aerr := store_phase_result(c, game, seat, result)
+		if aerr != nil {
+			return aerr
+		}
+	}
+
+	return nil
+}
+
+func before_game_over(c appengine.Context, game data.Game) *web.AppError {
+	return store_phase_results(c, game, game.BeforeGameOver())
+}
+
 func start_mission(c appengine.Context, game data.Game, proposal data.Proposal) *web.AppError {
 	mission_size := game.Setup.Missions[game.State.ThisMission].Size
 	actions := data.Actions{
@@ -149,7 +196,12 @@ func start_mission(c appengine.Context, game data.Game, proposal data.Proposal)
 }
 
 func StartPicking(c appengine.Context, game data.Game) *web.AppError {
-	aerr := ai_proposal(c, game)
+	aerr := store_phase_results(c, game, game.BeforePicking())
+	if aerr != nil {
+		return aerr
+	}
+
+	aerr = ai_proposal(c, game)
 	if aerr != nil {
 		return aerr
 	}
@@ -166,14 +218,14 @@ func do_proposal(c appengine.Context, game data.Game, players []int) *web.AppErr
 		return &web.AppError{err, "Error retrieving old proposal", 500}
 	} else if oldproposal != nil {
 		m := "Proposal has already been made"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrAlreadyActed), m, 409}
 	}
 
 	if game.State.ThisProposal == 4 {
 		// We represent the 5th proposal as having been unanimously approved
 		for i := range proposal.Votes {
 			proposal.Votes[i] = true
-			proposal.Votes[i] = true
+			proposal.Voted[i] = true
 		}
 	}
 
@@ -214,6 +266,11 @@ func check_votes(c appengine.Context, game data.Game, proposal data.Proposal) *w
 			return &web.AppError{err, "Error storing vote result", 500}
 		}
 
+		aerr := store_phase_results(c, game, game.AfterVote(voteresult))
+		if aerr != nil {
+			return aerr
+		}
+
 		// Count the number of approve/reject votes
 		approves, rejects := count_bools(proposal.Votes)
 
@@ -234,6 +291,7 @@ func check_votes(c appengine.Context, game data.Game, proposal data.Proposal) *w
 			}
 		} else {
 			// Move to next proposal
+			game.State.HaveProposal = false
 			game.State.ThisProposal++
 			game.State.Leader++
 			if game.State.Leader >= len(game.Roles) {
@@ -322,6 +380,11 @@ func check_actions(c appengine.Context, game data.Game, proposal data.Proposal,
 		game.State.MissionsComplete[result.Mission] = true
 		results = append(results, &result)
 
+		aerr := store_phase_results(c, game, game.AfterMission(result))
+		if aerr != nil {
+			return aerr
+		}
+
 		game.State.GoodScore, game.State.EvilScore = count_score(results)
 		gameFinishing := (game.State.GoodScore >= 3) || (game.State.EvilScore >= 3)
 
@@ -330,9 +393,16 @@ func check_actions(c appengine.Context, game data.Game, proposal data.Proposal,
 			// If good has won on points and we need an assassination
 			// phase, don't end the game just yet
 			if game.FindAssassin() == -1 || game.State.EvilScore >= 3 {
+				aerr := before_game_over(c, game)
+				if aerr != nil {
+					return aerr
+				}
 				game.State.GameOver = true
 			} else {
-				ai_assassinate(c, game)
+				aerr := ai_assassinate(c, game)
+				if aerr != nil {
+					return aerr
+				}
 			}
 
 			err = db.StoreGameState(c, game)
@@ -361,7 +431,7 @@ func check_actions(c appengine.Context, game data.Game, proposal data.Proposal,
 			return &web.AppError{err, "Error storing game", 500}
 		}
 
-		aerr := StartPicking(c, game)
+		aerr = StartPicking(c, game)
 		if aerr != nil {
 			return aerr
 		}
@@ -374,7 +444,7 @@ func do_action(c appengine.Context, game data.Game, mypos int, action bool, prop
 	mpos, ok := proposal.LookupMissionSlot(mypos)
 	if !ok {
 		m := "Position is not on this mission"
-		return &web.AppError{errors.New(m), m, 500}
+		return &web.AppError{web.Coded(api.ErrNotYourTurn), m, 403}
 	}
 
 	actions.Actions[mpos] = action
@@ -398,6 +468,11 @@ func do_action(c appengine.Context, game data.Game, mypos int, action bool, prop
 func do_assassin(c appengine.Context, game data.Game, target int) *web.AppError {
 	// We don't need to do anything more than record it, game is over now...
 	game.State.AssassinTarget = target
+
+	aerr := before_game_over(c, game)
+	if aerr != nil {
+		return aerr
+	}
 	game.State.GameOver = true
 
 	err := db.StoreGameState(c, game)
@@ -414,61 +489,75 @@ type ProposeData struct {
 	Players []int `json:"players"`
 }
 
-func ValidateGamePropose(game data.Game, proposedata ProposeData, mypos int) *web.AppError {
+// This returns the error for a move on a proposal which is no longer
+// current, with the current one so the client can catch up
+func stale_proposal(game data.Game, m string) *web.AppError {
+	details := api.StaleProposal{Mission: game.State.ThisMission + 1, Proposal: game.State.ThisProposal + 1}
+	return &web.AppError{web.ClientError{api.ErrStaleProposal, details}, m, 409}
+}
+
+func ValidateGamePropose(move Move, proposedata ProposeData, mypos int) *web.AppError {
+	game := move.Game
 	if game.State.GameOver {
 		m := "This game is over"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrGameOver), m, 409}
 	}
 
 	if game.State.Leader != mypos {
 		m := "You are not the leader"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrNotYourTurn), m, 403}
 	}
 
 	if proposedata.Mission != game.State.ThisMission || proposedata.Proposal != game.State.ThisProposal {
-		m := "Proposal is not current"
-		return &web.AppError{errors.New(m), m, 400}
+		return stale_proposal(game, "Proposal is not current")
+	}
+
+	if move.Proposal != nil {
+		m := "Proposal has already been made"
+		return &web.AppError{web.Coded(api.ErrAlreadyActed), m, 409}
 	}
 
 	if len(proposedata.Players) != game.Setup.Missions[game.State.ThisMission].Size {
 		m := "Sent wrong number of users"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrInvalidMove), m, 400}
 	}
 
+	seen := map[int]bool{}
 	for _, pos := range proposedata.Players {
 		if pos < 0 || pos >= len(game.Roles) {
 			m := "Invalid position in proposal"
-			return &web.AppError{errors.New(m), m, 400}
+			return &web.AppError{web.Coded(api.ErrInvalidMove), m, 400}
 		}
+		if seen[pos] {
+			m := "Duplicate position in proposal"
+			return &web.AppError{web.Coded(api.ErrInvalidMove), m, 400}
+		}
+		seen[pos] = true
 	}
 
 	return nil
 }
 
-func ReqGamePropose(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
-	err := db.EnsureGameState(c, &game, true)
-	if err != nil {
-		return &web.AppError{err, "Error retrieving game state", 500}
-	}
+func (proposedata *ProposeData) Validate(c appengine.Context, move Move, mypos int) *web.AppError {
+	return ValidateGamePropose(move, *proposedata, mypos)
+}
 
+func (proposedata *ProposeData) Apply(c appengine.Context, move Move, mypos int) *web.AppError {
+	return do_proposal(c, move.Game, proposedata.Players)
+}
+
+func ReqGamePropose(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
 	var proposedata ProposeData
-	err = json.NewDecoder(r.Body).Decode(&proposedata)
+	err := json.NewDecoder(r.Body).Decode(&proposedata)
 	if err != nil {
-		return &web.AppError{err, "Error parsing json body", 500}
+		return web.JSONError(err)
 	}
 
 	// These are 1-based in the ajax API
 	proposedata.Mission--
 	proposedata.Proposal--
 
-	aerr := ValidateGamePropose(game, proposedata, mypos)
-	if aerr != nil {
-		return aerr
-	}
-
-	aerr = trans.RunGameTransaction(c, &game, func(tc appengine.Context, game data.Game) *web.AppError {
-		return do_proposal(tc, game, proposedata.Players)
-	})
+	aerr := RunCommand(c, &game, mypos, &proposedata)
 	if aerr != nil {
 		return aerr
 	}
@@ -482,65 +571,65 @@ type VoteData struct {
 	Vote string `json:"vote"`
 }
 
-func ValidateGameVote(game data.Game, votedata VoteData) *web.AppError {
+func ValidateGameVote(move Move, mypos int, votedata VoteData) *web.AppError {
+	game := move.Game
 	if game.State.GameOver {
 		m := "This game is over"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrGameOver), m, 409}
 	}
 
 	if game.State.ThisProposal >= 4 {
 		m := "There is no vote on this mission"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrWrongPhase), m, 409}
 	}
 
 	if votedata.Mission != game.State.ThisMission || votedata.Proposal != game.State.ThisProposal {
-		m := "Vote is not for the current proposal"
-		return &web.AppError{errors.New(m), m, 400}
+		return stale_proposal(game, "Vote is not for the current proposal")
+	}
+
+	if move.Proposal == nil {
+		m := "There is no proposal to vote on"
+		return &web.AppError{web.Coded(api.ErrWrongPhase), m, 409}
+	}
+
+	if move.Actions != nil || game.State.HaveActions {
+		return stale_proposal(game, "Voting on this proposal is over")
+	}
+
+	// Votes are final, as mission actions are
+	if mypos < len(move.Proposal.Voted) && move.Proposal.Voted[mypos] {
+		m := "You have already voted"
+		return &web.AppError{web.Coded(api.ErrAlreadyActed), m, 409}
 	}
 
 	if votedata.Vote != "approve" && votedata.Vote != "reject" {
 		m := "Invalid vote"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrInvalidMove), m, 400}
 	}
 
 	return nil
 }
 
-func ReqGameVote(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
-	err := db.EnsureGameState(c, &game, true)
-	if err != nil {
-		return &web.AppError{err, "Error retrieving game state", 500}
-	}
+func (votedata *VoteData) Validate(c appengine.Context, move Move, mypos int) *web.AppError {
+	return ValidateGameVote(move, mypos, *votedata)
+}
 
+func (votedata *VoteData) Apply(c appengine.Context, move Move, mypos int) *web.AppError {
+	return do_vote(c, move.Game, mypos, votedata.Vote == "approve", move.Proposal)
+}
+
+func ReqGameVote(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
 	var votedata VoteData
-	err = json.NewDecoder(r.Body).Decode(&votedata)
+	err := json.NewDecoder(r.Body).Decode(&votedata)
 	if err != nil {
-		return &web.AppError{err, "Error parsing json body", 500}
+		return web.JSONError(err)
 	}
 
 	// These are 1-based in the ajax API
 	votedata.Mission--
 	votedata.Proposal--
 
-	aerr := ValidateGameVote(game, votedata)
-	if aerr != nil {
-		return aerr
-	}
-
-	vote := votedata.Vote == "approve"
-
-	aerr = trans.RunGameTransaction(c, &game, func(tc appengine.Context, game data.Game) *web.AppError {
-		proposal, err := db.GetProposal(c, true, game, game.State.ThisMission, game.State.ThisProposal)
-		if err != nil {
-			return &web.AppError{err, "Error fetching proposal", 500}
-		}
-		if proposal == nil {
-			m := "Proposal not found"
-			return &web.AppError{errors.New(m), m, 500}
-		}
-
-		return do_vote(tc, game, mypos, vote, proposal)
-	})
+	aerr := RunCommand(c, &game, mypos, &votedata)
 	if aerr != nil {
 		return aerr
 	}
@@ -554,38 +643,39 @@ type ActionData struct {
 	Action string `json:"action"`
 }
 
-func ValidateGameMission(game data.Game, actiondata ActionData, mypos int, proposal *data.Proposal) *web.AppError {
+func ValidateGameMission(move Move, actiondata ActionData, mypos int) *web.AppError {
+	game := move.Game
+	proposal := move.Proposal
 	if game.State.GameOver {
 		m := "This game is over"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrGameOver), m, 409}
 	}
 
-	if proposal == nil {
+	if proposal == nil || move.Actions == nil {
 		m := "No mission is in progress"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrWrongPhase), m, 409}
 	}
 
 	_, unvoted := count_bools(proposal.Voted)
 	approved, rejected := count_bools(proposal.Votes)
-	if unvoted != 0 || approved < rejected {
+	if unvoted != 0 || approved <= rejected {
 		m := "This proposal has not been approved"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrWrongPhase), m, 409}
 	}
 
-	found := false
-	for _, pos := range proposal.Players {
-		if pos == mypos {
-			found = true
-		}
-	}
+	mpos, found := proposal.LookupMissionSlot(mypos)
 	if !found {
 		m := "You are not on this mission"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrNotYourTurn), m, 403}
+	}
+
+	if move.Actions.Acted[mpos] {
+		m := "You have already acted on this mission"
+		return &web.AppError{web.Coded(api.ErrAlreadyActed), m, 409}
 	}
 
 	if actiondata.Mission != game.State.ThisMission || actiondata.Proposal != game.State.ThisProposal {
-		m := "Action is not for the current proposal"
-		return &web.AppError{errors.New(m), m, 400}
+		return stale_proposal(game, "Action is not for the current proposal")
 	}
 
 	myrole := game.Roles[mypos]
@@ -595,56 +685,32 @@ func ValidateGameMission(game data.Game, actiondata ActionData, mypos int, propo
 
 	if !permitted {
 		m := "Invalid action " + actiondata.Action
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrInvalidMove), m, 400}
 	}
 
 	return nil
 }
 
-func ReqGameMission(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
-	err := db.EnsureGameState(c, &game, true)
-	if err != nil {
-		return &web.AppError{err, "Error retrieving game state", 500}
-	}
-
-	actions, err := db.GetActions(c, true, game, game.State.ThisMission)
-	if err != nil {
-		return &web.AppError{err, "Error retrieving actions", 500}
-	}
+func (actiondata *ActionData) Validate(c appengine.Context, move Move, mypos int) *web.AppError {
+	return ValidateGameMission(move, *actiondata, mypos)
+}
 
-	var proposal *data.Proposal
-	if actions != nil {
-		proposal, err = db.GetProposal(c, true, game, game.State.ThisMission, actions.Proposal)
-		if err != nil {
-			return &web.AppError{err, "Error retrieving proposal", 500}
-		}
-	}
+func (actiondata *ActionData) Apply(c appengine.Context, move Move, mypos int) *web.AppError {
+	return do_action(c, move.Game, mypos, actiondata.Action == "Success", *move.Proposal, move.Actions)
+}
 
+func ReqGameMission(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
 	var actiondata ActionData
-	err = json.NewDecoder(r.Body).Decode(&actiondata)
+	err := json.NewDecoder(r.Body).Decode(&actiondata)
 	if err != nil {
-		return &web.AppError{err, "Error parsing json body", 500}
+		return web.JSONError(err)
 	}
 
 	// These are 1-based in the ajax API
 	actiondata.Mission--
 	actiondata.Proposal--
 
-	aerr := ValidateGameMission(game, actiondata, mypos, proposal)
-
-	action := actiondata.Action == "Success"
-
-	aerr = trans.RunGameTransaction(c, &game, func(tc appengine.Context, game data.Game) *web.AppError {
-		actions, err := db.GetActions(c, true, game, game.State.ThisMission)
-		if err != nil {
-			return &web.AppError{err, "Error retrieving actions", 500}
-		}
-		if actions == nil {
-			return &web.AppError{err, "Actions object not found for current mission", 500}
-		}
-
-		return do_action(tc, game, mypos, action, *proposal, actions)
-	})
+	aerr := RunCommand(c, &game, mypos, &actiondata)
 	if aerr != nil {
 		return aerr
 	}
@@ -656,50 +722,86 @@ type AssassinData struct {
 	Target int `json:"target"`
 }
 
-func ValidateGameAssassin(game data.Game, assassindata AssassinData, mypos int) *web.AppError {
+func ValidateGameAssassin(move Move, assassindata AssassinData, mypos int) *web.AppError {
+	game := move.Game
 	if game.State.GameOver {
 		m := "This game is over"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrGameOver), m, 409}
+	}
+
+	if game.State.GoodScore < 3 {
+		m := "This is not the assassination phase"
+		return &web.AppError{web.Coded(api.ErrWrongPhase), m, 409}
 	}
 
 	if game.FindAssassin() != mypos {
 		m := "You are not the assassin"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrNotYourTurn), m, 403}
 	}
 
 	if assassindata.Target < 0 || assassindata.Target >= len(game.Roles) {
 		m := "Invalid position in proposal"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrInvalidMove), m, 400}
 	}
 
-	if game.Cards[assassindata.Target].AllocatedAsSpy() {
+	if game.Cards[game.Roles[assassindata.Target]].AllocatedAsSpy() {
 		m := "Must target a good player"
-		return &web.AppError{errors.New(m), m, 400}
+		return &web.AppError{web.Coded(api.ErrInvalidMove), m, 400}
 	}
 
 	return nil
 }
 
-func ReqGameAssassin(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
-	err := db.EnsureGameState(c, &game, true)
-	if err != nil {
-		return &web.AppError{err, "Error retrieving game state", 500}
-	}
+func (assassindata *AssassinData) Validate(c appengine.Context, move Move, mypos int) *web.AppError {
+	return ValidateGameAssassin(move, *assassindata, mypos)
+}
 
+func (assassindata *AssassinData) Apply(c appengine.Context, move Move, mypos int) *web.AppError {
+	return do_assassin(c, move.Game, assassindata.Target)
+}
+
+func ReqGameAssassin(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
 	var assassindata AssassinData
-	err = json.NewDecoder(r.Body).Decode(&assassindata)
+	err := json.NewDecoder(r.Body).Decode(&assassindata)
 	if err != nil {
-		return &web.AppError{err, "Error parsing json body", 500}
+		return web.JSONError(err)
 	}
 
-	aerr := ValidateGameAssassin(game, assassindata, mypos)
+	aerr := RunCommand(c, &game, mypos, &assassindata)
 	if aerr != nil {
 		return aerr
 	}
 
-	aerr = trans.RunGameTransaction(c, &game, func(tc appengine.Context, game data.Game) *web.AppError {
-		return do_assassin(tc, game, assassindata.Target)
-	})
+	return state.ReqGameState(w, r, c, session, game, mypos)
+}
+
+// Poking isn't a move as such - it re-runs the end of vote and end of
+// mission checks, in case an earlier request failed part way through
+type PokeData struct {
+}
+
+func (pokedata *PokeData) Validate(c appengine.Context, move Move, mypos int) *web.AppError {
+	if move.Game.State.GameOver {
+		m := "This game is over"
+		return &web.AppError{web.Coded(api.ErrGameOver), m, 409}
+	}
+	return nil
+}
+
+func (pokedata *PokeData) Apply(c appengine.Context, move Move, mypos int) *web.AppError {
+	if move.Proposal == nil {
+		return nil
+	}
+
+	if move.Actions == nil {
+		return check_votes(c, move.Game, *move.Proposal)
+	}
+
+	return check_actions(c, move.Game, *move.Proposal, *move.Actions)
+}
+
+func ReqGamePoke(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	aerr := RunCommand(c, &game, mypos, &PokeData{})
 	if aerr != nil {
 		return aerr
 	}
@@ -707,31 +809,71 @@ func ReqGameAssassin(w http.ResponseWriter, r *http.Request, c appengine.Context
 	return state.ReqGameState(w, r, c, session, game, mypos)
 }
 
-func ReqGamePoke(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
-	aerr := trans.RunGameTransaction(c, &game, func(tc appengine.Context, game data.Game) *web.AppError {
-		proposal, err := db.GetProposal(tc, true, game, game.State.ThisMission, game.State.ThisProposal)
-		if err != nil {
-			return &web.AppError{err, "Error retrieving proposal", 500}
-		}
+type DecideData struct {
+	Decision int64 `json:"decision"`
+	Choice int `json:"choice"`
 
-		actions, err := db.GetActions(tc, true, game, game.State.ThisMission)
-		if err != nil {
-			return &web.AppError{err, "Error fetching actions", 500}
-		}
+	decision *data.Decision
+}
 
-		aerr := check_votes(tc, game, *proposal)
-		if aerr != nil {
-			return aerr
-		}
+func ValidateGameDecide(move Move, decidedata DecideData, mypos int, decision *data.Decision) *web.AppError {
+	if move.Game.State.GameOver {
+		m := "This game is over"
+		return &web.AppError{web.Coded(api.ErrGameOver), m, 409}
+	}
 
-		aerr = check_actions(tc, game, *proposal, *actions)
-		if aerr != nil {
-			return aerr
+	if decision == nil || decision.Seat != mypos || decision.Resolved {
+		m := "No such decision pending"
+		return &web.AppError{web.Coded(api.ErrWrongPhase), m, 409}
+	}
+
+	for _, pos := range decision.Players {
+		if pos == decidedata.Choice {
+			return nil
 		}
+	}
+
+	m := "Invalid choice for this decision"
+	return &web.AppError{web.Coded(api.ErrInvalidMove), m, 400}
+}
+
+func (decidedata *DecideData) Validate(c appengine.Context, move Move, mypos int) *web.AppError {
+	decision, err := db.GetDecision(c, move.Game, decidedata.Decision)
+	if err != nil {
+		return &web.AppError{err, "Error retrieving decision", 500}
+	}
+	decidedata.decision = decision
+
+	return ValidateGameDecide(move, *decidedata, mypos, decision)
+}
+
+func (decidedata *DecideData) Apply(c appengine.Context, move Move, mypos int) *web.AppError {
+	return do_decide(c, move.Game, mypos, *decidedata.decision, decidedata.Choice)
+}
 
+func do_decide(c appengine.Context, game data.Game, mypos int, decision data.Decision, choice int) *web.AppError {
+	decision.Resolved = true
+	decision.Choice = choice
+	_, err := db.StoreDecision(c, game, decision)
+	if err != nil {
+		return &web.AppError{err, "Error storing decision", 500}
+	}
+
+	hook, ok := game.Cards[game.Roles[mypos]].(data.DecisionHook)
+	if !ok {
 		return nil
-	})
+	}
+	return store_phase_result(c, game, mypos, hook.Decide(game, mypos, decision, choice))
+}
+
+func ReqGameDecide(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	var decidedata DecideData
+	err := json.NewDecoder(r.Body).Decode(&decidedata)
+	if err != nil {
+		return web.JSONError(err)
+	}
 
+	aerr := RunCommand(c, &game, mypos, &decidedata)
 	if aerr != nil {
 		return aerr
 	}
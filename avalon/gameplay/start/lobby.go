@@ -0,0 +1,125 @@
+package start
+
+import (
+	"appengine"
+	"avalon/api"
+	"avalon/data"
+	"avalon/db"
+	"avalon/gameplay/state"
+	"avalon/rooms"
+	"avalon/web"
+	"errors"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func init() {
+	http.Handle("/room/start", web.AjaxHandler(ReqRoomStart))
+}
+
+func ValidateRoomStart(c appengine.Context, room data.Room, userID string) *web.AppError {
+	if room.Owner != userID {
+		m := "Only the host can start the game"
+		return &web.AppError{web.Coded(api.ErrNotHost), m, 403}
+	}
+
+	if !room.AllReady() {
+		m := "Not everybody is ready"
+		return &web.AppError{web.Coded(api.ErrNotReady), m, 409}
+	}
+
+	// With fewer, get_player_data would add AIs of its own
+	if len(room.Names) + room.AIs < 5 {
+		m := "Need at least five players, counting AIs"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	pgame, err := db.FindOrCreateGame(c, room.Id, nil)
+	if err != nil {
+		return &web.AppError{err, "Error looking for current game", 500}
+	}
+	if pgame != nil {
+		m := "There is already a game in progress"
+		return &web.AppError{web.Coded(api.ErrGameInProgress), m, 409}
+	}
+
+	return nil
+}
+
+// This starts a game with everybody in the lobby and the host's
+// settings, once everybody is ready. If the settings ask for a series
+// this starts it, and its later games come from /series/next. The
+// other players join with /game/join.
+func ReqRoomStart(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	pgame, mypos, aerr := StartRoomGame(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	err := session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+
+	return state.ReqGameState(w, r, c, session, *pgame, mypos)
+}
+
+// This starts the game as ReqRoomStart does, and returns it with the
+// host's seat. The session is joined to the game but not saved.
+func StartRoomGame(c appengine.Context, session *sessions.Session) (*data.Game, int, *web.AppError) {
+	proom, _, aerr := rooms.GetLobby(c, session)
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+	room := *proom
+
+	userID, _ := session.Values["userID"].(string)
+	aerr = ValidateRoomStart(c, room, userID)
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	participants := map[string]string{}
+	for i, name := range room.Names {
+		participants[name] = room.UserIDs[i]
+	}
+	for i := 0; i < room.AIs; i++ {
+		participants["ai_" + strconv.Itoa(i + 1)] = "ai"
+	}
+
+	var pgame *data.Game
+	var mypos int
+	if room.Series {
+		seriesstartdata := SeriesStartData{participants, room.Cards, room.BestOf, room.FixedSeating, room.RotateRoles}
+		aerr = ValidateSeriesStart(session, seriesstartdata)
+		if aerr != nil {
+			return nil, -1, aerr
+		}
+
+		pgame, mypos, aerr = start_series(c, session, seriesstartdata)
+	} else {
+		gamestartdata := GameStartData{participants, room.Cards}
+		aerr = ValidateGameStart(session, gamestartdata)
+		if aerr != nil {
+			return nil, -1, aerr
+		}
+
+		pgame, mypos, aerr = DoGameStartOrJoin(c, session, game_factory(gamestartdata))
+	}
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	// The next game needs another ready check
+	_, aerr = rooms.UpdateRoom(c, room.Id, func(room *data.Room) *web.AppError {
+		room.ClearReady()
+		return nil
+	})
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	return pgame, mypos, nil
+}
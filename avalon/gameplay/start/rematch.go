@@ -0,0 +1,249 @@
+package start
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/api"
+	"avalon/data"
+	"avalon/db"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func init() {
+	http.Handle("/game/rematch", web.GameHandler(ReqGameRematch))
+}
+
+type RematchData struct {
+	// Leave this out to see how the rematch is going without answering
+	Accept *bool `json:"accept"`
+}
+
+type RematchResponse struct {
+	Responses []string `json:"responses"`
+	// When the rematch stops waiting for answers
+	Deadline time.Time `json:"deadline"`
+	// The answers are in, and nobody but the AIs accepted
+	Cancelled bool `json:"cancelled"`
+	Started bool `json:"started"`
+	// The session has moved to the new game, and /game/state will
+	// return it
+	Joined bool `json:"joined"`
+}
+
+func is_ai(game data.Game, seat int) bool {
+	for _, ai := range game.AIs {
+		if ai == seat {
+			return true
+		}
+	}
+	return false
+}
+
+func new_rematch(game data.Game, now time.Time) data.Rematch {
+	rematch := data.Rematch{
+		Responses: make([]string, len(game.UserIDs)),
+		Deadline: now.Add(data.RematchTimeout),
+	}
+	for _, seat := range game.AIs {
+		rematch.Responses[seat] = data.RematchAccept
+	}
+	return rematch
+}
+
+func humans_accepted(game data.Game, rematch data.Rematch) int {
+	n := 0
+	for seat, response := range rematch.Responses {
+		if response == data.RematchAccept && !is_ai(game, seat) {
+			n++
+		}
+	}
+	return n
+}
+
+// The rematch has the same cards, and everybody who accepted. The
+// seats of those who declined go to AIs, so that the cards still fit.
+// Seats and roles are dealt again.
+func rematch_factory(game data.Game, playerids []string, rematch data.Rematch) db.GameFactory {
+	return func(gameid string, roomid string) (data.Game, []string) {
+		used := map[string]bool{}
+		for _, id := range playerids {
+			used[id] = true
+		}
+
+		ai := 0
+		player_data := make([]PlayerData, 0)
+		for seat, response := range rematch.Responses {
+			if is_ai(game, seat) || response == data.RematchAccept {
+				player_data = append(player_data, PlayerData{UserID: game.UserIDs[seat], Name: playerids[seat]})
+				continue
+			}
+
+			name := ""
+			for name == "" || used[name] {
+				ai++
+				name = "ai_" + strconv.Itoa(ai)
+			}
+			used[name] = true
+			player_data = append(player_data, PlayerData{UserID: "ai", Name: name})
+		}
+
+		players, ordered_participants := shuffle_players(player_data)
+		return make_game(gameid, roomid, players, ordered_participants, game.Setup.Cards, mathrand.Perm(len(players)))
+	}
+}
+
+func ValidateRematch(game data.Game) *web.AppError {
+	if !game.State.GameOver {
+		m := "The game is not over yet"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	if game.Series != "" {
+		m := "Games in a series continue with the next game of the series"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	return nil
+}
+
+func ReqGameRematch(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
+	var rematchdata RematchData
+	err := json.NewDecoder(r.Body).Decode(&rematchdata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	response, aerr := AnswerRematch(w, r, c, session, game, mypos, rematchdata)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err = json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
+
+// This records the player's answer to a rematch of their finished
+// game. Once everybody has answered, or at the deadline, the rematch
+// starts without those who haven't answered. Everybody who accepted is
+// moved into it the next time they call this or /game/join, and the
+// old game's state names it.
+func AnswerRematch(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int, rematchdata RematchData) (RematchResponse, *web.AppError) {
+	aerr := ValidateRematch(game)
+	if aerr != nil {
+		return RematchResponse{}, aerr
+	}
+
+	var rematch data.Rematch
+	var pgame *data.Game
+	now := time.Now()
+	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		aerr = nil
+		pgame = nil
+		prematch, err := db.GetRematch(tc, game)
+		if err != nil {
+			return err
+		}
+		if prematch == nil {
+			rematch = new_rematch(game, now)
+		} else {
+			rematch = *prematch
+		}
+
+		// Once it has started the answers are final
+		if rematch.Game != "" {
+			return nil
+		}
+
+		if rematchdata.Accept != nil {
+			rematch.Responses[mypos] = data.RematchDecline
+			if *rematchdata.Accept {
+				rematch.Responses[mypos] = data.RematchAccept
+			}
+		}
+
+		if rematch.Closed(now) && humans_accepted(game, rematch) > 0 {
+			// Those who didn't answer in time are left out
+			for seat, response := range rematch.Responses {
+				if response == "" {
+					rematch.Responses[seat] = data.RematchDecline
+				}
+			}
+
+			current, err := db.FindOrCreateGame(tc, game.Room, nil)
+			if err != nil {
+				return err
+			}
+			if current != nil {
+				m := "There is already a game in progress"
+				aerr = &web.AppError{web.Coded(api.ErrGameInProgress), m, 409}
+				return nil
+			}
+
+			playerids, err := db.GetPlayerIDs(tc, game)
+			if err != nil {
+				return err
+			}
+
+			pgame, err = db.FindOrCreateGame(tc, game.Room, rematch_factory(game, playerids, rematch))
+			if err != nil {
+				return err
+			}
+			rematch.Game = pgame.Id
+		}
+
+		return db.StoreRematch(tc, game, rematch)
+	}, nil)
+	if err != nil {
+		return RematchResponse{}, &web.AppError{err, "Error updating rematch", 500}
+	}
+	if aerr != nil {
+		return RematchResponse{}, aerr
+	}
+
+	response := RematchResponse{
+		Responses: rematch.Responses,
+		Deadline: rematch.Deadline,
+		Cancelled: rematch.Closed(now) && humans_accepted(game, rematch) == 0,
+		Started: rematch.Game != "",
+	}
+
+	if rematch.Game != "" && rematch.Responses[mypos] == data.RematchAccept {
+		if pgame == nil {
+			pgame, err = db.RetrieveGame(c, game.Room, rematch.Game)
+			if err != nil {
+				return RematchResponse{}, &web.AppError{err, "Error retrieving rematch", 500}
+			}
+		}
+
+		aerr = DoStartGame(c, pgame)
+		if aerr != nil {
+			return RematchResponse{}, aerr
+		}
+
+		_, aerr = JoinGame(c, session, *pgame)
+		if aerr != nil {
+			return RematchResponse{}, aerr
+		}
+		response.Joined = true
+
+		err = session.Save(r, w)
+		if err != nil {
+			log.Println("error saving session:", err)
+		}
+	}
+
+	return response, nil
+}
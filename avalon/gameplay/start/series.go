@@ -0,0 +1,276 @@
+package start
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/api"
+	"avalon/data"
+	"avalon/db"
+	"avalon/gameplay/state"
+	"avalon/series"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"sort"
+)
+
+func init() {
+	http.Handle("/series/start", web.AjaxHandler(ReqSeriesStart))
+	http.Handle("/series/next", web.AjaxHandler(ReqSeriesNext))
+	http.Handle("/series/summary", web.AjaxHandler(ReqSeriesSummary))
+}
+
+type SeriesStartData struct {
+	Participants map[string]string `json:"players"`
+	Cards []string `json:"cards"`
+	BestOf int `json:"best_of"`
+	FixedSeating bool `json:"fixed_seating"`
+	RotateRoles bool `json:"rotate_roles"`
+}
+
+func series_factory(current data.Series) db.GameFactory {
+	return func(gameid string, roomid string) (data.Game, []string) {
+		seats, roles := series.PlanGame(current)
+		names := make([]string, len(seats))
+		userids := make([]string, len(seats))
+		for seat, participant := range seats {
+			names[seat] = current.Names[participant]
+			userids[seat] = current.UserIDs[participant]
+		}
+
+		game, players := make_game(gameid, roomid, names, userids, current.Cards, roles)
+		game.Series = current.Id
+		game.SeriesSeats = seats
+		return game, players
+	}
+}
+
+func ValidateSeriesStart(session *sessions.Session, seriesstartdata SeriesStartData) *web.AppError {
+	aerr := ValidateGameStart(session, GameStartData{seriesstartdata.Participants, seriesstartdata.Cards})
+	if aerr != nil {
+		return aerr
+	}
+
+	if seriesstartdata.BestOf < 0 {
+		m := "Invalid number of games"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	return nil
+}
+
+func ReqSeriesStart(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var seriesstartdata SeriesStartData
+	err := json.NewDecoder(r.Body).Decode(&seriesstartdata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	pgame, mypos, aerr := StartSeries(c, session, seriesstartdata)
+	if aerr != nil {
+		return aerr
+	}
+
+	err = session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+
+	return state.ReqGameState(w, r, c, session, *pgame, mypos)
+}
+
+// This starts a series in the session's room, outside a lobby, and
+// joins its first game. The caller must save the session.
+func StartSeries(c appengine.Context, session *sessions.Session, seriesstartdata SeriesStartData) (*data.Game, int, *web.AppError) {
+	aerr := check_no_lobby(c, session)
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	aerr = ValidateSeriesStart(session, seriesstartdata)
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	return start_series(c, session, seriesstartdata)
+}
+
+// This stores a new series in the session's room, which must not have
+// a game in progress, and starts its first game. The series and the
+// game are made in one transaction, so that a series never exists
+// without a game.
+func start_series(c appengine.Context, session *sessions.Session, seriesstartdata SeriesStartData) (*data.Game, int, *web.AppError) {
+	roomID := web.SessionRoomID(session)
+
+	player_data := get_player_data(GameStartData{seriesstartdata.Participants, seriesstartdata.Cards})
+	names := make([]string, len(player_data))
+	userids := make([]string, len(player_data))
+	for i, player := range player_data {
+		names[i] = player.Name
+		userids[i] = player.UserID
+	}
+	current := series.NewSeries(roomID, names, userids, seriesstartdata.Cards, seriesstartdata.BestOf, seriesstartdata.FixedSeating, seriesstartdata.RotateRoles)
+
+	var pgame *data.Game
+	var aerr *web.AppError
+	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		// The transaction may be retried
+		aerr = nil
+
+		pcurrent, err := db.FindOrCreateGame(tc, roomID, nil)
+		if err != nil {
+			return err
+		}
+		if pcurrent != nil {
+			m := "There is already a game in progress"
+			aerr = &web.AppError{web.Coded(api.ErrGameInProgress), m, 409}
+			return nil
+		}
+
+		err = db.StoreSeries(tc, current)
+		if err != nil {
+			return err
+		}
+
+		pgame, err = db.FindOrCreateGame(tc, roomID, series_factory(current))
+		return err
+	}, nil)
+	if err != nil {
+		return nil, -1, &web.AppError{err, "Error starting series", 500}
+	}
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	mypos, aerr := start_and_join(c, session, pgame)
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	return pgame, mypos, nil
+}
+
+func get_current_series(c appengine.Context, session *sessions.Session) (*data.Series, *web.AppError) {
+	userID, ok := session.Values["userID"].(string)
+	if !ok || 0 == len(userID) {
+		m := "Not authenticated via oauth"
+		return nil, &web.AppError{web.Coded(api.ErrNotAuthenticated), m, 401}
+	}
+
+	roomID := web.SessionRoomID(session)
+	current, err := db.CurrentSeries(c, roomID)
+	if err != nil {
+		return nil, &web.AppError{err, "Error retrieving series", 500}
+	}
+	if current == nil {
+		m := "No series in this room"
+		return nil, &web.AppError{errors.New(m), m, 404}
+	}
+
+	for _, id := range current.UserIDs {
+		if id == userID {
+			return current, nil
+		}
+	}
+	m := "Not a player in this series"
+	return nil, &web.AppError{errors.New(m), m, 403}
+}
+
+func ReqSeriesNext(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	pgame, mypos, aerr := NextSeriesGame(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	err := session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+
+	return state.ReqGameState(w, r, c, session, *pgame, mypos)
+}
+
+// This starts the next game of the series with the same participants,
+// or joins it if somebody else already has. The caller must save the
+// session.
+func NextSeriesGame(c appengine.Context, session *sessions.Session) (*data.Game, int, *web.AppError) {
+	current, aerr := get_current_series(c, session)
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	if current.Over() {
+		m := "This series is over"
+		return nil, -1, &web.AppError{errors.New(m), m, 400}
+	}
+
+	return DoGameStartOrJoin(c, session, series_factory(*current))
+}
+
+type SeriesStanding struct {
+	Name string `json:"name"`
+	Score int `json:"score"`
+	Played int `json:"played"`
+	EvilCount int `json:"evil_count"`
+}
+
+type byScore []SeriesStanding
+
+func (s byScore) Len() int           { return len(s) }
+func (s byScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool { return s[i].Score > s[j].Score }
+
+type SeriesSummaryResponse struct {
+	Series data.Series `json:"series"`
+	Over bool `json:"over"`
+	// Best first
+	Standings []SeriesStanding `json:"standings"`
+	GoodWins int `json:"good_wins"`
+	EvilWins int `json:"evil_wins"`
+}
+
+func ReqSeriesSummary(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	response, aerr := GetSeriesSummary(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err := json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
+
+// This sums up the series in the session's room, which the session's
+// user must be playing in
+func GetSeriesSummary(c appengine.Context, session *sessions.Session) (SeriesSummaryResponse, *web.AppError) {
+	current, aerr := get_current_series(c, session)
+	if aerr != nil {
+		return SeriesSummaryResponse{}, aerr
+	}
+
+	response := SeriesSummaryResponse{
+		Series: *current,
+		Over: current.Over(),
+		Standings: make([]SeriesStanding, len(current.Names)),
+	}
+	for i, name := range current.Names {
+		response.Standings[i] = SeriesStanding{name, current.Scores[i], current.Played[i], current.EvilCounts[i]}
+	}
+	sort.Stable(byScore(response.Standings))
+	for _, result := range current.Results {
+		if result.Winner == "good" {
+			response.GoodWins++
+		} else {
+			response.EvilWins++
+		}
+	}
+
+	return response, nil
+}
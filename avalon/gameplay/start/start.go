@@ -3,12 +3,14 @@ package start
 import (
 	"appengine"
 	"appengine/datastore"
+	"avalon/api"
 	"avalon/data"
 	"avalon/data/cards"
 	"avalon/db"
 	"avalon/db/trans"
 	"avalon/gameplay"
 	"avalon/gameplay/state"
+	"avalon/gameplay/view"
 	"avalon/web"
 	"encoding/json"
 	"errors"
@@ -23,6 +25,8 @@ import (
 
 func init() {
 	http.Handle("/game/setup", web.AjaxHandler(ReqGameSetup))
+	http.Handle("/game/knowledge", web.AjaxHandler(ReqGameKnowledge))
+	http.Handle("/game/checkcards", web.AjaxHandler(ReqGameCheckCards))
 	http.Handle("/game/start", web.AjaxHandler(ReqGameStart))
 	http.Handle("/game/join", web.AjaxHandler(ReqGameJoin))
 	http.Handle("/game/reveal", web.GameHandler(ReqGameReveal))
@@ -51,63 +55,74 @@ func shuffle_players(player_data []PlayerData) ([]string, []string) {
 	return players, ordered_participants
 }
 
-func game_factory(gamestartdata GameStartData) db.GameFactory {
-	return func(gameid string, hangoutid string) (data.Game, []string) {
-		player_data := make([]PlayerData, 0)
-		for k, v := range gamestartdata.Participants {
-			player_data = append(player_data, PlayerData{UserID: v, Name: k})
+// This builds a new game. names and userids are the players in seat
+// order, and roles gives the card for each seat.
+func make_game(gameid string, roomid string, names []string, userids []string, labels []string, roles []int) (data.Game, []string) {
+	ais := make([]int, 0)
+	for i, id := range names {
+		if strings.HasPrefix(id, "ai_") {
+			ais = append(ais, i)
 		}
+	}
 
-		ai_count := 0
-		if len(player_data) < 5 {
-			ai_count = 5 - len(player_data)
-		}
+	setup := data.GetSizeSetup(len(names))
+	setup.Cards = labels
+
+	gamestatic := data.GameStatic{
+		Id: gameid,
+		Room: roomid,
+		StartTime: time.Now(),
+		UserIDs: userids,
+		AIs: ais,
+		Setup: setup,
+		Roles: roles,
+	}
+	gamestate := data.GameState{
+		DataVersion: db.CurrentDataVersion(),
 
-		// Fake it for testing purposes
-		for i := 0; i < ai_count; i++ {
-			player_data = append(player_data, PlayerData{UserID: "ai", Name: "ai_" + strconv.Itoa(i + 1)})
-		}
+		HaveProposal: false,
 
-		players, ordered_participants := shuffle_players(player_data)
-		ais := make([]int, 0)
-		for i, id := range players {
-			if strings.HasPrefix(id, "ai_") {
-				ais = append(ais, i)
-			}
-		}
+		Leader: -1, // See comment in ReqGameStart - this is the "start of game" marker
+		ThisProposal: 0,
+		HaveActions: false,
 
-		setup := data.GetSizeSetup(len(players))
-		setup.Cards = gamestartdata.Cards
-
-		gamestatic := data.GameStatic{
-			Id: gameid,
-			Hangout: hangoutid,
-			StartTime: time.Now(),
-			UserIDs: ordered_participants,
-			AIs: ais,
-			Setup: setup,
-			Roles: mathrand.Perm(len(players)),
-		}
-		gamestate := data.GameState{
-			DataVersion: 1,
+		ThisMission: 0,
+		MissionsComplete: make([]bool, len(gamestatic.Setup.Missions)),
+		GoodScore: 0,
+		EvilScore: 0,
+		AssassinTarget: -1,
+		GameOver: false,
 
-			HaveProposal: false,
+		ThisVote: 0,
+	}
 
-			Leader: -1, // See comment in ReqGameStart - this is the "start of game" marker
-			ThisProposal: 0,
-			HaveActions: false,
+	return data.Game{GameStatic: gamestatic, State: &gamestate}, names
+}
 
-			ThisMission: 0,
-			MissionsComplete: make([]bool, len(gamestatic.Setup.Missions)),
-			GoodScore: 0,
-			EvilScore: 0,
-			AssassinTarget: -1,
-			GameOver: false,
+// This returns the participants, with AIs added to make up the numbers
+func get_player_data(gamestartdata GameStartData) []PlayerData {
+	player_data := make([]PlayerData, 0)
+	for k, v := range gamestartdata.Participants {
+		player_data = append(player_data, PlayerData{UserID: v, Name: k})
+	}
 
-			ThisVote: 0,
-		}
+	ai_count := 0
+	if len(player_data) < 5 {
+		ai_count = 5 - len(player_data)
+	}
 
-		return data.Game{GameStatic: gamestatic, State: &gamestate}, players
+	// Fake it for testing purposes
+	for i := 0; i < ai_count; i++ {
+		player_data = append(player_data, PlayerData{UserID: "ai", Name: "ai_" + strconv.Itoa(i + 1)})
+	}
+
+	return player_data
+}
+
+func game_factory(gamestartdata GameStartData) db.GameFactory {
+	return func(gameid string, roomid string) (data.Game, []string) {
+		players, ordered_participants := shuffle_players(get_player_data(gamestartdata))
+		return make_game(gameid, roomid, players, ordered_participants, gamestartdata.Cards, mathrand.Perm(len(players)))
 	}
 }
 
@@ -133,9 +148,9 @@ func DoStartGame(c appengine.Context, game *data.Game) *web.AppError {
 func DoGameStartOrJoin(c appengine.Context, session *sessions.Session, factory db.GameFactory) (*data.Game, int, *web.AppError) {
 	var pgame *data.Game
 	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
-		hangoutID, _ := session.Values["hangoutID"].(string)
+		roomID := web.SessionRoomID(session)
 		var dberr error
-		pgame, dberr = db.FindOrCreateGame(tc, hangoutID, factory)
+		pgame, dberr = db.FindOrCreateGame(tc, roomID, factory)
 		return dberr
 	}, nil)
 	if err != nil {
@@ -147,17 +162,22 @@ func DoGameStartOrJoin(c appengine.Context, session *sessions.Session, factory d
 		return nil, -1, &web.AppError{errors.New(m), m, 404}
 	}
 
-	aerr := DoStartGame(c, pgame)
+	mypos, aerr := start_and_join(c, session, pgame)
 	if aerr != nil {
 		return nil, -1, aerr
 	}
 
-	mypos, aerr := JoinGame(c, session, *pgame)
+	return pgame, mypos, nil
+}
+
+// This makes a game's first move if nobody has yet, and joins it
+func start_and_join(c appengine.Context, session *sessions.Session, pgame *data.Game) (int, *web.AppError) {
+	aerr := DoStartGame(c, pgame)
 	if aerr != nil {
-		return nil, -1, aerr
+		return -1, aerr
 	}
 
-	return pgame, mypos, nil
+	return JoinGame(c, session, *pgame)
 }
 
 func JoinGame(c appengine.Context, session *sessions.Session, game data.Game) (int, *web.AppError) {
@@ -168,7 +188,7 @@ func JoinGame(c appengine.Context, session *sessions.Session, game data.Game) (i
 	mypos, ok := game.LookupUserID(userID)
 	if !ok {
 		m := "Not a user in the current game"
-		return -1, &web.AppError{errors.New(m), m, 500}
+		return -1, &web.AppError{web.Coded(api.ErrNotInGame), m, 403}
 	}
 
 	// Our participantID might have changed since the game started (if
@@ -185,26 +205,11 @@ func JoinGame(c appengine.Context, session *sessions.Session, game data.Game) (i
 	return mypos, nil
 }
 
-func GetGameReveal(game data.Game, mypos int) []data.GameReveal {
-	myrole := game.Roles[mypos]
-	mycard := game.Cards[myrole]
-
-	reveals := make([]data.GameReveal, 1)
-
-	reveals[0] = data.GameReveal{Label: "Your card: " + mycard.Label(), Players: []int{} }
-
-	for _, reveal := range mycard.Reveal(game) {
-		reveals = append(reveals, reveal)
-	}
-
-	return reveals
-}
-
 func ValidateGameStart(session *sessions.Session, gamestartdata GameStartData) *web.AppError {
 	userID, ok := session.Values["userID"].(string)
 	if !ok || 0 == len(userID) {
 		m := "Not authenticated via oauth"
-		return &web.AppError{errors.New(m), m, 403}
+		return &web.AppError{web.Coded(api.ErrNotAuthenticated), m, 401}
 	}
 
 	participant_count := len(gamestartdata.Participants)
@@ -224,44 +229,32 @@ func ValidateGameStart(session *sessions.Session, gamestartdata GameStartData) *
 		return &web.AppError{errors.New(m), m, 400}
 	}
 
-	cardCounts := map[string]int{}
-	cardops := make([]data.CardOps, len(gamestartdata.Cards))
-	for i, label := range gamestartdata.Cards {
-		ctor, ok := cards.CardFactory[label]
-		if !ok {
-			m := "Invalid card " + label
-			return &web.AppError{errors.New(m), m, 400}
-		}
-
-		cardops[i] = ctor()
-		cardCounts[label] = cardCounts[label] + 1
+	// Warnings are for the setup screen, and don't stop the game
+	problems, _ := cards.CheckCardSet(gamestartdata.Cards)
+	if len(problems) > 0 {
+		m := problems[0]
+		return &web.AppError{errors.New(m), m, 400}
 	}
 
-	assassin := cardops[0]
-	evilCount := 0
-	for _, card := range cardops {
-		if card.Maximum() > 0 && card.Maximum() < cardCounts[card.Label()] {
-			m := "Too many copies of " + card.Label()
-			return &web.AppError{errors.New(m), m, 400}
-		}
-
-		if card.AllocatedAsSpy() {
-			evilCount++
-		}
+	return nil
+}
 
-		if card.AssassinPriority() > assassin.AssassinPriority() {
-			assassin = card
-		}
+// Rooms with a lobby start their games from the lobby, once everybody
+// is ready (see ReqRoomStart). A hangout has no lobby, so there the
+// client says who is playing.
+func check_no_lobby(c appengine.Context, session *sessions.Session) *web.AppError {
+	roomID := web.SessionRoomID(session)
+	if roomID == "" {
+		m := "Not in a room"
+		return &web.AppError{web.Coded(api.ErrNotInRoom), m, 403}
 	}
 
-	if evilCount != setup.Spies {
-		m := "Wrong number of evil cards for this number of players"
-		return &web.AppError{errors.New(m), m, 400}
+	proom, err := db.GetRoom(c, roomID)
+	if err != nil {
+		return &web.AppError{err, "Error retrieving room", 500}
 	}
-
-	_, haveMerlin := cardCounts["Merlin"]
-	if haveMerlin && assassin.AssassinPriority() == 0 {
-		m := "Must have an assassin with Merlin in play"
+	if proom != nil {
+		m := "Games in this room start from its lobby"
 		return &web.AppError{errors.New(m), m, 400}
 	}
 
@@ -272,10 +265,15 @@ func ReqGameStart(w http.ResponseWriter, r *http.Request, c appengine.Context, s
 	var gamestartdata GameStartData
 	err := json.NewDecoder(r.Body).Decode(&gamestartdata)
 	if err != nil {
-		return &web.AppError{err, "Error parsing json body", 500}
+		return web.JSONError(err)
 	}
 
-	aerr := ValidateGameStart(session, gamestartdata)
+	aerr := check_no_lobby(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	aerr = ValidateGameStart(session, gamestartdata)
 	if aerr != nil {
 		return aerr
 	}
@@ -297,7 +295,7 @@ func ValidateGameJoin(session *sessions.Session) *web.AppError {
 	userID, ok := session.Values["userID"].(string)
 	if !ok || 0 == len(userID) {
 		m := "Not authenticated via oauth"
-		return &web.AppError{errors.New(m), m, 403}
+		return &web.AppError{web.Coded(api.ErrNotAuthenticated), m, 401}
 	}
 
 	return nil
@@ -322,8 +320,23 @@ func ReqGameJoin(w http.ResponseWriter, r *http.Request, c appengine.Context, se
 	return state.ReqGameState(w, r, c, session, *pgame, mypos)
 }
 
+// This returns everything a seat has been shown about the others
+func LoadGameReveal(c appengine.Context, game data.Game, mypos int) ([]data.GameReveal, *web.AppError) {
+	reveals := view.GetGameReveal(game, mypos)
+
+	// Phase hooks may have revealed more to us since the start
+	seatreveals, err := db.GetSeatReveals(c, game, mypos)
+	if err != nil {
+		return nil, &web.AppError{err, "Error retrieving seat reveals", 500}
+	}
+	return append(reveals, seatreveals...), nil
+}
+
 func ReqGameReveal(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, game data.Game, mypos int) *web.AppError {
-	reveals := GetGameReveal(game, mypos)
+	reveals, aerr := LoadGameReveal(c, game, mypos)
+	if aerr != nil {
+		return aerr
+	}
 
 	w.Header().Set("Content-type", "application/json")
 	err := json.NewEncoder(w).Encode(&reveals)
@@ -342,24 +355,44 @@ type GameSetupResponse struct {
 	Setup data.GameSetup `json:"setup"`
 	GoodCards []string `json:"good_cards"`
 	EvilCards []string `json:"evil_cards"`
+	Cards []cards.CardInfo `json:"cards"`
 }
 
 func ReqGameSetup(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
 	var gamesetupdata GameSetupData
 	err := json.NewDecoder(r.Body).Decode(&gamesetupdata)
 	if err != nil {
-		return &web.AppError{err, "Error parsing json body", 500}
+		return web.JSONError(err)
 	}
 
+	response, aerr := GetGameSetup(gamesetupdata)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err = json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
+
+// This returns the missions for a game with this many players, and
+// every card there is to choose from
+func GetGameSetup(gamesetupdata GameSetupData) (GameSetupResponse, *web.AppError) {
 	setup := data.GetSizeSetup(gamesetupdata.Players)
 	if len(setup.Missions) == 0 {
 		m := "Invalid number of players"
-		return &web.AppError{errors.New(m), m, 400}
+		return GameSetupResponse{}, &web.AppError{errors.New(m), m, 400}
 	}
 
 	goodCards := []string{}
 	evilCards := []string{}
+	cardInfo := []cards.CardInfo{}
 	for _, card := range cards.AllCards() {
+		cardInfo = append(cardInfo, cards.GetCardInfo(card))
 		if card.AllocatedAsSpy() {
 			evilCards = append(evilCards, card.Label())
 		} else {
@@ -367,7 +400,30 @@ func ReqGameSetup(w http.ResponseWriter, r *http.Request, c appengine.Context, s
 		}
 	}
 
-	response := GameSetupResponse{setup, goodCards, evilCards}
+	return GameSetupResponse{setup, goodCards, evilCards, cardInfo}, nil
+}
+
+type GameKnowledgeData struct {
+	Cards []string `json:"cards"`
+}
+
+type GameKnowledgeResponse struct {
+	Knowledge []cards.CardKnowledge `json:"knowledge"`
+}
+
+func ReqGameKnowledge(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var gameknowledgedata GameKnowledgeData
+	err := json.NewDecoder(r.Body).Decode(&gameknowledgedata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	knowledge, err := cards.GetKnowledge(gameknowledgedata.Cards)
+	if err != nil {
+		return &web.AppError{err, err.Error(), 400}
+	}
+
+	response := GameKnowledgeResponse{knowledge}
 
 	w.Header().Set("Content-type", "application/json")
 	err = json.NewEncoder(w).Encode(&response)
@@ -377,3 +433,57 @@ func ReqGameSetup(w http.ResponseWriter, r *http.Request, c appengine.Context, s
 
 	return nil
 }
+
+type GameCheckCardsData struct {
+	Players int `json:"players"`
+	Cards []string `json:"cards"`
+	// If this is set, the cards are filled out with the standard ones
+	// before checking (see cards.StandardCardSet)
+	Suggest bool `json:"suggest"`
+}
+
+type GameCheckCardsResponse struct {
+	Cards []string `json:"cards"`
+	Problems []string `json:"problems"`
+	Warnings []string `json:"warnings"`
+}
+
+func ReqGameCheckCards(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var checkdata GameCheckCardsData
+	err := json.NewDecoder(r.Body).Decode(&checkdata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	response, aerr := CheckCards(checkdata)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err = json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
+
+// This checks a card set for a game, after filling it out if asked to
+func CheckCards(checkdata GameCheckCardsData) (GameCheckCardsResponse, *web.AppError) {
+	labels := checkdata.Cards
+	if checkdata.Suggest {
+		var err error
+		labels, err = cards.StandardCardSet(checkdata.Players, checkdata.Cards)
+		if err != nil {
+			return GameCheckCardsResponse{}, &web.AppError{err, err.Error(), 400}
+		}
+	}
+
+	problems, warnings := cards.CheckCardSet(labels)
+	if len(labels) != checkdata.Players {
+		problems = append(problems, "Mismatching number of players and cards")
+	}
+
+	return GameCheckCardsResponse{labels, problems, warnings}, nil
+}
@@ -0,0 +1,188 @@
+// Package view builds what each seat is shown of a game. It does no
+// datastore access, so the leak auditor can run it outside App Engine.
+package view
+
+import (
+	"avalon/data"
+	"avalon/data/cards"
+)
+
+type GameStateGeneral struct {
+	Id string `json:"gameid"`
+	Setup data.GameSetup `json:"setup"`
+	Players []string `json:"players"`
+	State string `json:"state"`
+	Leader int `json:"leader"`
+	Results []*data.MissionResult `json:"mission_results"`
+	Votes []data.VoteResult `json:"votes"`
+	ThisMission int `json:"this_mission"`
+	ThisProposal int `json:"this_proposal"`
+	Decisions []data.Decision `json:"decisions"`
+}
+
+type GameStatePicking struct {
+	General GameStateGeneral `json:"general"`
+	MissionSize int `json:"mission_size"`
+	MissionFailsAllowed int `json:"mission_fails_allowed"`
+}
+
+type GameStateVoting struct {
+	General GameStateGeneral `json:"general"`
+	MissionPlayers []int `json:"mission_players"`
+	VotedPlayers []bool `json:"voted_players"`
+}
+
+type GameStateMission struct {
+	General GameStateGeneral `json:"general"`
+	MissionPlayers []int `json:"mission_players"`
+	ActedPlayers []bool `json:"acted_players"`
+	AllowActions map[string]bool `json:"allow_actions"`
+}
+
+type GameStateAssassination struct {
+	General GameStateGeneral `json:"general"`
+	Assassin int `json:"assassin"`
+	Cards []string `json:"cards"`
+}
+
+type GameStateOver struct {
+	General GameStateGeneral `json:"general"`
+	AssassinTarget int `json:"assassin_target"`
+	Result string `json:"result"`
+	Comment string `json:"comment"`
+	Cards []string `json:"cards"`
+	// "good" or "evil", and whether that is the seat's side
+	Winner string `json:"winner"`
+	Won bool `json:"won"`
+	// The rematch's game id, once it has started
+	Rematch string `json:"rematch"`
+}
+
+func MakeGameState(game data.Game, playerids []string, results []*data.MissionResult, proposal *data.Proposal, actions *data.Actions, votes []data.VoteResult, decisions []data.Decision, mypos int) interface{} {
+	general := GameStateGeneral{
+		Id: game.Id,
+		Setup: game.Setup,
+		Players: playerids,
+		State: "",
+		Leader: game.State.Leader,
+		Results: results,
+		Votes: votes,
+		ThisMission: game.State.ThisMission + 1,
+		ThisProposal: game.State.ThisProposal + 1,
+		Decisions: decisions,
+	}
+
+	if game.State.GameOver {
+		var result string
+		var comment string
+		winner := "evil"
+		if cards.GoodHasWon(game) {
+			winner = "good"
+		}
+
+		if game.State.AssassinTarget != -1 && game.Cards[game.Roles[game.State.AssassinTarget]].Label() == "Merlin" {
+			result = "Merlin has been assassinated"
+		} else if winner == "good" {
+			result = "Good has won"
+		} else {
+			result = "Evil has won"
+		}
+
+		myrole := game.Roles[mypos]
+		mycard := game.Cards[myrole]
+		won := mycard.HasWon(game)
+		if won {
+			comment = "Victory!"
+		} else {
+			comment = "Defeat!"
+		}
+
+		cards := make([]string, len(game.Roles))
+		for i, role := range game.Roles {
+			cards[i] = game.Cards[role].Label()
+		}
+
+		general.State = "gameover"
+		return GameStateOver{
+			General: general,
+			AssassinTarget: game.State.AssassinTarget,
+			Result: result,
+			Comment: comment,
+			Cards: cards,
+			Winner: winner,
+			Won: won,
+		}
+	}
+
+	if game.State.GoodScore >= 3 {
+		// Must be in the assassination phase
+		assassin := game.FindAssassin()
+		if assassin == -1 {
+			panic("Should be in assassination phase, but we have no assassin!")
+		}
+
+		// The evil players are shown to everybody for the assassination
+		cards := make([]string, len(game.Roles))
+		for i, role := range game.Roles {
+			if game.Cards[role].AllocatedAsSpy() {
+				cards[i] = game.Cards[role].Label()
+			}
+		}
+
+		general.State = "assassination"
+		return GameStateAssassination{
+			General: general,
+			Assassin: assassin,
+			Cards: cards,
+		}
+	}
+
+	if proposal == nil {
+		general.State = "picking"
+		return GameStatePicking{
+			General: general,
+			MissionSize: game.Setup.Missions[game.State.ThisMission].Size,
+			MissionFailsAllowed: game.Setup.Missions[game.State.ThisMission].FailsAllowed,
+		}
+	}
+
+	missionplayers := make([]int, len(proposal.Players))
+	for i, n := range proposal.Players {
+		missionplayers[i] = n
+	}
+
+	if actions == nil {
+		general.State = "voting"
+		return GameStateVoting{
+			General: general,
+			MissionPlayers: missionplayers,
+			VotedPlayers: proposal.Voted,
+		}
+	}
+
+	general.State = "mission"
+
+	myrole := game.Roles[mypos]
+	return GameStateMission{
+		General: general,
+		MissionPlayers: missionplayers,
+		ActedPlayers: actions.Acted,
+		AllowActions: game.Cards[myrole].PermittedActions(game, *proposal),
+	}
+}
+
+
+func GetGameReveal(game data.Game, mypos int) []data.GameReveal {
+	myrole := game.Roles[mypos]
+	mycard := game.Cards[myrole]
+
+	reveals := make([]data.GameReveal, 1)
+
+	reveals[0] = data.GameReveal{Label: "Your card: " + mycard.Label(), Players: []int{} }
+
+	for _, reveal := range mycard.Reveal(game) {
+		reveals = append(reveals, reveal)
+	}
+
+	return reveals
+}
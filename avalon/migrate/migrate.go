@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"appengine"
+	"avalon/data"
+	"avalon/db"
+	"avalon/db/trans"
+	"avalon/web"
+	"errors"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+func init() {
+	http.Handle("/admin/migrate", web.AppHandler(ReqMigrate))
+}
+
+// Games are migrated in batches, so that each request finishes well
+// inside the request deadline. Each batch reports where to carry on
+// from.
+const defaultBatchSize = 20
+
+type batchResult struct {
+	Games int
+	OldGames int
+	Entities int
+	// Number of old games by the oldest version found in them
+	Versions map[int]int
+	Errors []string
+	Cursor string
+}
+
+func migrateBatch(c appengine.Context, cursor string, limit int, dryRun bool) (batchResult, error) {
+	result := batchResult{Versions: map[int]int{}, Errors: []string{}}
+
+	games, next, err := db.GamesFrom(c, cursor, limit)
+	if err != nil {
+		return result, err
+	}
+	result.Games = len(games)
+	if len(games) > 0 {
+		result.Cursor = next
+	}
+
+	for _, game := range games {
+		var oldest, count int
+		aerr := trans.RunGameTransaction(c, &game, func(tc appengine.Context, game data.Game) *web.AppError {
+			var err error
+			oldest, count, err = db.MigrateGame(tc, game, dryRun)
+			if err != nil {
+				return &web.AppError{err, "Error migrating game", 500}
+			}
+			return nil
+		})
+		if aerr != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s/%s: %s: %s", game.Room, game.Id, aerr.Message, aerr.Err))
+			continue
+		}
+		if count > 0 {
+			result.OldGames++
+			result.Entities += count
+			result.Versions[oldest]++
+		}
+	}
+
+	return result, nil
+}
+
+// With dry_run (the default) this only reports what would be
+// migrated. Actually migrating needs a POST with dry_run=0.
+func ReqMigrate(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	dryRun := r.FormValue("dry_run") != "0"
+	if !dryRun && r.Method != "POST" {
+		m := "Migrating needs a POST"
+		return &web.AppError{errors.New(m), m, 405}
+	}
+
+	limit := defaultBatchSize
+	if r.FormValue("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(r.FormValue("limit"))
+		if err != nil || limit <= 0 {
+			m := "Invalid limit"
+			return &web.AppError{errors.New(m), m, 400}
+		}
+	}
+
+	result, err := migrateBatch(c, r.FormValue("cursor"), limit, dryRun)
+	if err != nil {
+		return &web.AppError{err, "Error listing games", 500}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "Current data version %d\n", db.CurrentDataVersion())
+	for _, migration := range db.GetMigrations() {
+		fmt.Fprintf(w, "  %d: %s\n", migration.Version, migration.Description)
+	}
+	if dryRun {
+		fmt.Fprintf(w, "Dry run - nothing has been written\n")
+	}
+	fmt.Fprintf(w, "Checked %d games, %d need migrating (%d entities)\n", result.Games, result.OldGames, result.Entities)
+	for version, count := range result.Versions {
+		fmt.Fprintf(w, "  %d games from version %d\n", count, version)
+	}
+	for _, e := range result.Errors {
+		fmt.Fprintln(w, "Error:", e)
+	}
+
+	if result.Games < limit {
+		fmt.Fprintf(w, "All games done\n")
+	} else {
+		next := url.Values{}
+		next.Set("cursor", result.Cursor)
+		next.Set("limit", strconv.Itoa(limit))
+		if !dryRun {
+			next.Set("dry_run", "0")
+		}
+		fmt.Fprintf(w, "Next batch: /admin/migrate?%s\n", next.Encode())
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package ratings
+
+import (
+	"appengine"
+	"avalon/api"
+	"avalon/data"
+	"avalon/db"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"math"
+	"net/http"
+	"time"
+)
+
+func init() {
+	http.Handle("/ratings/leaderboard", web.AjaxHandler(ReqLeaderboard))
+}
+
+// These are ordinary Elo ratings, with each side of a game rated as a
+// team: a team's rating is the mean of its players' ratings for that
+// side, and every player on the team moves by the team's change
+const (
+	initialRating = 1500.0
+	kFactor = 32.0
+)
+
+func newRating(scope string, userid string) data.Rating {
+	return data.Rating{
+		UserID: userid,
+		Scope: scope,
+		Guest: data.IsGuest(userid),
+		Good: initialRating,
+		Evil: initialRating,
+		Overall: initialRating,
+	}
+}
+
+type ratedSeat struct {
+	Seat int
+	Evil bool
+	Won bool
+}
+
+// This returns the seats which are rated - everybody except the AIs
+func ratedSeats(game data.Game) []ratedSeat {
+	isAI := map[int]bool{}
+	for _, seat := range game.AIs {
+		isAI[seat] = true
+	}
+
+	seats := []ratedSeat{}
+	for seat, userid := range game.UserIDs {
+		if isAI[seat] || userid == "" || seat >= len(game.Roles) {
+			continue
+		}
+		card := game.Cards[game.Roles[seat]]
+		seats = append(seats, ratedSeat{seat, card.AllocatedAsSpy(), card.HasWon(game)})
+	}
+	return seats
+}
+
+func expected(rating float64, opponent float64) float64 {
+	return 1 / (1 + math.Pow(10, (opponent - rating) / 400))
+}
+
+func rateScope(c appengine.Context, game data.Game, scope string, seats []ratedSeat) error {
+	ratings := make([]data.Rating, len(seats))
+	total := map[bool]float64{}
+	count := map[bool]int{}
+	for i, seat := range seats {
+		userid := game.UserIDs[seat.Seat]
+		prating, err := db.GetRating(c, scope, userid)
+		if err != nil {
+			return err
+		}
+		if prating == nil {
+			ratings[i] = newRating(scope, userid)
+		} else {
+			ratings[i] = *prating
+		}
+
+		if seat.Evil {
+			total[true] += ratings[i].Evil
+		} else {
+			total[false] += ratings[i].Good
+		}
+		count[seat.Evil]++
+	}
+
+	// A side with nobody rated on it (all AIs) counts as a new player
+	team := map[bool]float64{}
+	for _, evil := range []bool{false, true} {
+		team[evil] = initialRating
+		if count[evil] > 0 {
+			team[evil] = total[evil] / float64(count[evil])
+		}
+	}
+
+	now := time.Now()
+	for i, seat := range seats {
+		score := 0.0
+		if seat.Won {
+			score = 1.0
+		}
+		change := kFactor * (score - expected(team[seat.Evil], team[!seat.Evil]))
+
+		rating := &ratings[i]
+		if seat.Evil {
+			rating.Evil += change
+			rating.EvilGames++
+			if seat.Won {
+				rating.EvilWins++
+			}
+		} else {
+			rating.Good += change
+			rating.GoodGames++
+			if seat.Won {
+				rating.GoodWins++
+			}
+		}
+		rating.Overall = (rating.Good + rating.Evil) / 2
+		rating.Updated = now
+
+		err := db.StoreRating(c, *rating)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This updates the global and room ratings of everybody in a game
+// which has just finished. It must be called exactly once per game,
+// in the same (cross-group) transaction that ends the game. Games
+// which never finish are never rated.
+func RateGame(c appengine.Context, game data.Game) error {
+	if !game.State.GameOver {
+		return errors.New("Cannot rate a game which is not over")
+	}
+
+	seats := ratedSeats(game)
+	if len(seats) == 0 {
+		return nil
+	}
+
+	err := rateScope(c, game, "", seats)
+	if err != nil {
+		return err
+	}
+	return rateScope(c, game, game.Room, seats)
+}
+
+type LeaderboardData struct {
+	// Either "global" or "room" (the room of the current session)
+	Scope string `json:"scope"`
+	// One of "good", "evil" or "overall"
+	Side string `json:"side"`
+	Limit int `json:"limit"`
+	IncludeGuests bool `json:"include_guests"`
+}
+
+type LeaderboardEntry struct {
+	Rank int `json:"rank"`
+	Rating data.Rating `json:"rating"`
+}
+
+type LeaderboardResponse struct {
+	Scope string `json:"scope"`
+	Side string `json:"side"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+var sideProperties = map[string]string{
+	"good": "Good",
+	"evil": "Evil",
+	"overall": "Overall",
+}
+
+func ReqLeaderboard(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var leaderboarddata LeaderboardData
+	err := json.NewDecoder(r.Body).Decode(&leaderboarddata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	scope := ""
+	switch leaderboarddata.Scope {
+	case "", "global":
+		leaderboarddata.Scope = "global"
+	case "room", "hangout":
+		scope = web.SessionRoomID(session)
+		if scope == "" {
+			m := "Not in a room"
+			return &web.AppError{web.Coded(api.ErrNotInRoom), m, 403}
+		}
+	default:
+		m := "Invalid scope " + leaderboarddata.Scope
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	if leaderboarddata.Side == "" {
+		leaderboarddata.Side = "overall"
+	}
+	property, ok := sideProperties[leaderboarddata.Side]
+	if !ok {
+		m := "Invalid side " + leaderboarddata.Side
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	if leaderboarddata.Limit <= 0 || leaderboarddata.Limit > 100 {
+		leaderboarddata.Limit = 20
+	}
+
+	ratings, err := db.GetLeaderboard(c, scope, property, leaderboarddata.IncludeGuests, leaderboarddata.Limit)
+	if err != nil {
+		return &web.AppError{err, "Error retrieving leaderboard", 500}
+	}
+
+	response := LeaderboardResponse{
+		Scope: leaderboarddata.Scope,
+		Side: leaderboarddata.Side,
+		Entries: make([]LeaderboardEntry, len(ratings)),
+	}
+	for i, rating := range ratings {
+		response.Entries[i] = LeaderboardEntry{i + 1, rating}
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err = json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
@@ -0,0 +1,548 @@
+package rooms
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"avalon/api"
+	"avalon/data"
+	"avalon/data/cards"
+	"avalon/db"
+	"avalon/web"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func init() {
+	http.Handle("/room/create", web.AjaxHandler(ReqRoomCreate))
+	http.Handle("/room/join", web.AjaxHandler(ReqRoomJoin))
+	http.Handle("/room/lobby", web.AjaxHandler(ReqRoomLobby))
+	http.Handle("/room/ready", web.AjaxHandler(ReqRoomReady))
+	http.Handle("/room/settings", web.AjaxHandler(ReqRoomSettings))
+	http.Handle("/room/leave", web.AjaxHandler(ReqRoomLeave))
+	http.Handle("/room/", web.AppHandler(ReqRoomInvite))
+}
+
+const codeLength = 6
+
+type RoomCreateData struct {
+	Name string `json:"name"`
+}
+
+type RoomJoinData struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type RoomReadyData struct {
+	Ready bool `json:"ready"`
+}
+
+type RoomSettingsData struct {
+	Cards []string `json:"cards"`
+	AIs int `json:"ais"`
+	Series bool `json:"series"`
+	BestOf int `json:"best_of"`
+	FixedSeating bool `json:"fixed_seating"`
+	RotateRoles bool `json:"rotate_roles"`
+}
+
+type RoomResponse struct {
+	Room data.Room `json:"room"`
+	// The host's name
+	Host string `json:"host"`
+	AllReady bool `json:"all_ready"`
+	// The invite link, which anybody can open to find the room
+	Link string `json:"link"`
+	// Whether a game is being played in the room
+	InGame bool `json:"in_game"`
+}
+
+func invite_link(r *http.Request, code string) string {
+	return "https://" + r.Host + "/room/" + code
+}
+
+func ValidateName(name string) *web.AppError {
+	if name == "" {
+		m := "Need a name"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+	// Participant IDs starting ai_ are how games recognise the AIs
+	if strings.HasPrefix(name, "ai_") {
+		m := "Invalid name " + name
+		return &web.AppError{errors.New(m), m, 400}
+	}
+	return nil
+}
+
+func get_user_id(session *sessions.Session) (string, *web.AppError) {
+	userID, ok := session.Values["userID"].(string)
+	if !ok || 0 == len(userID) {
+		m := "Not authenticated via oauth"
+		return "", &web.AppError{web.Coded(api.ErrNotAuthenticated), m, 401}
+	}
+	return userID, nil
+}
+
+func enter_room(w http.ResponseWriter, r *http.Request, session *sessions.Session, room data.Room, name string) {
+	session.Values["roomID"] = room.Id
+	session.Values["participantID"] = name
+	err := session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+}
+
+// This returns what /room/lobby and the other room requests answer
+// with
+func MakeRoomResponse(r *http.Request, c appengine.Context, room data.Room) (*RoomResponse, *web.AppError) {
+	pgame, err := db.FindOrCreateGame(c, room.Id, nil)
+	if err != nil {
+		return nil, &web.AppError{err, "Error looking for current game", 500}
+	}
+
+	host := ""
+	if pos, ok := room.LookupUserID(room.Owner); ok {
+		host = room.Names[pos]
+	}
+
+	return &RoomResponse{
+		Room: room,
+		Host: host,
+		AllReady: room.AllReady(),
+		Link: invite_link(r, room.Code),
+		InGame: pgame != nil,
+	}, nil
+}
+
+func send_room(w http.ResponseWriter, r *http.Request, c appengine.Context, room data.Room) *web.AppError {
+	response, aerr := MakeRoomResponse(r, c, room)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
+
+// This makes a new room, with the session user in its lobby
+func ReqRoomCreate(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var roomcreatedata RoomCreateData
+	err := json.NewDecoder(r.Body).Decode(&roomcreatedata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	proom, aerr := CreateRoom(w, r, c, session, roomcreatedata)
+	if aerr != nil {
+		return aerr
+	}
+
+	return send_room(w, r, c, *proom)
+}
+
+// This makes a new room with the session user as its host, and puts
+// the session in it
+func CreateRoom(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, roomcreatedata RoomCreateData) (*data.Room, *web.AppError) {
+	userID, aerr := get_user_id(session)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	aerr = ValidateName(roomcreatedata.Name)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	var code string
+	for {
+		code = data.RandomCode(codeLength)
+		oldroom, err := db.FindRoomByCode(c, code)
+		if err != nil {
+			return nil, &web.AppError{err, "Error checking room code", 500}
+		}
+		if oldroom == nil {
+			break
+		}
+	}
+
+	room := data.Room{
+		Id: data.RandomString(64),
+		Code: code,
+		Created: time.Now(),
+		Owner: userID,
+		Names: []string{roomcreatedata.Name},
+		UserIDs: []string{userID},
+		Ready: []bool{false},
+		Cards: []string{},
+	}
+	err := db.StoreRoom(c, room)
+	if err != nil {
+		return nil, &web.AppError{err, "Error storing room", 500}
+	}
+
+	enter_room(w, r, session, room, roomcreatedata.Name)
+	return &room, nil
+}
+
+func find_room(c appengine.Context, code string) (*data.Room, *web.AppError) {
+	proom, err := db.FindRoomByCode(c, strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil {
+		return nil, &web.AppError{err, "Error looking up room", 500}
+	}
+	if proom == nil {
+		m := "No room with that code"
+		return nil, &web.AppError{errors.New(m), m, 404}
+	}
+	return proom, nil
+}
+
+func ValidateJoin(room data.Room, userID string, name string) *web.AppError {
+	pos, ok := room.LookupName(name)
+	if ok && room.UserIDs[pos] != userID {
+		m := "Somebody in the room already has that name"
+		return &web.AppError{errors.New(m), m, 409}
+	}
+
+	_, ok = room.LookupUserID(userID)
+	if !ok && len(room.UserIDs) + room.AIs >= data.MaxRoomSize {
+		m := "The room is full"
+		return &web.AppError{web.Coded(api.ErrRoomFull), m, 409}
+	}
+
+	return nil
+}
+
+// This adds the session user to a room's lobby, or renames them if
+// they are already in it
+func ReqRoomJoin(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var roomjoindata RoomJoinData
+	err := json.NewDecoder(r.Body).Decode(&roomjoindata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	proom, aerr := JoinRoom(w, r, c, session, roomjoindata)
+	if aerr != nil {
+		return aerr
+	}
+
+	return send_room(w, r, c, *proom)
+}
+
+// This adds the session user to the lobby of the room with the code
+// given, and puts the session in the room
+func JoinRoom(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, roomjoindata RoomJoinData) (*data.Room, *web.AppError) {
+	userID, aerr := get_user_id(session)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	aerr = ValidateName(roomjoindata.Name)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	proom, aerr := find_room(c, roomjoindata.Code)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	room, aerr := UpdateRoom(c, proom.Id, func(room *data.Room) *web.AppError {
+		aerr := ValidateJoin(*room, userID, roomjoindata.Name)
+		if aerr != nil {
+			return aerr
+		}
+
+		pos, ok := room.LookupUserID(userID)
+		if ok {
+			room.Names[pos] = roomjoindata.Name
+		} else {
+			room.Names = append(room.Names, roomjoindata.Name)
+			room.UserIDs = append(room.UserIDs, userID)
+			room.Ready = append(room.Ready, false)
+		}
+		// An emptied room goes to whoever joins it next
+		if room.Owner == "" {
+			room.Owner = userID
+		}
+		return nil
+	})
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	enter_room(w, r, session, *room, roomjoindata.Name)
+	return room, nil
+}
+
+// This runs fn on a room in a transaction, and stores the room if fn
+// succeeds. It returns the room as stored.
+func UpdateRoom(c appengine.Context, roomID string, fn func(room *data.Room) *web.AppError) (*data.Room, *web.AppError) {
+	var room data.Room
+	var aerr *web.AppError
+	err := datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		proom, err := db.GetRoom(tc, roomID)
+		if err != nil {
+			return err
+		}
+		if proom == nil {
+			m := "No such room"
+			aerr = &web.AppError{errors.New(m), m, 404}
+			return nil
+		}
+		room = *proom
+
+		aerr = fn(&room)
+		if aerr != nil {
+			return nil
+		}
+		return db.StoreRoom(tc, room)
+	}, nil)
+	if err != nil {
+		return nil, &web.AppError{err, "Error updating room", 500}
+	}
+	if aerr != nil {
+		return nil, aerr
+	}
+	return &room, nil
+}
+
+// This returns the session's room, and where the session user is in
+// its lobby
+func GetLobby(c appengine.Context, session *sessions.Session) (*data.Room, int, *web.AppError) {
+	userID, aerr := get_user_id(session)
+	if aerr != nil {
+		return nil, -1, aerr
+	}
+
+	roomID := web.SessionRoomID(session)
+	if roomID == "" {
+		m := "Not in a room"
+		return nil, -1, &web.AppError{web.Coded(api.ErrNotInRoom), m, 403}
+	}
+
+	proom, err := db.GetRoom(c, roomID)
+	if err != nil {
+		return nil, -1, &web.AppError{err, "Error retrieving room", 500}
+	}
+	if proom == nil {
+		m := "This room has no lobby"
+		return nil, -1, &web.AppError{errors.New(m), m, 404}
+	}
+
+	pos, ok := proom.LookupUserID(userID)
+	if !ok {
+		m := "Not in this room's lobby"
+		return nil, -1, &web.AppError{web.Coded(api.ErrNotInRoom), m, 403}
+	}
+
+	return proom, pos, nil
+}
+
+// This returns the session's room, with who is in its lobby
+func ReqRoomLobby(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	proom, _, aerr := GetLobby(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	return send_room(w, r, c, *proom)
+}
+
+func ReqRoomReady(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var roomreadydata RoomReadyData
+	err := json.NewDecoder(r.Body).Decode(&roomreadydata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	proom, aerr := SetReady(c, session, roomreadydata)
+	if aerr != nil {
+		return aerr
+	}
+
+	return send_room(w, r, c, *proom)
+}
+
+func SetReady(c appengine.Context, session *sessions.Session, roomreadydata RoomReadyData) (*data.Room, *web.AppError) {
+	proom, _, aerr := GetLobby(c, session)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	userID, _ := session.Values["userID"].(string)
+	return UpdateRoom(c, proom.Id, func(room *data.Room) *web.AppError {
+		pos, ok := room.LookupUserID(userID)
+		if !ok {
+			m := "Not in this room's lobby"
+			return &web.AppError{web.Coded(api.ErrNotInRoom), m, 403}
+		}
+		room.Ready[pos] = roomreadydata.Ready
+		return nil
+	})
+}
+
+func ValidateRoomSettings(room data.Room, userID string, roomsettingsdata RoomSettingsData) *web.AppError {
+	if room.Owner != userID {
+		m := "Only the host can change the settings"
+		return &web.AppError{web.Coded(api.ErrNotHost), m, 403}
+	}
+
+	if roomsettingsdata.AIs < 0 || len(room.Names) + roomsettingsdata.AIs > data.MaxRoomSize {
+		m := "Invalid number of AIs"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	if roomsettingsdata.BestOf < 0 {
+		m := "Invalid number of games"
+		return &web.AppError{errors.New(m), m, 400}
+	}
+
+	// The cards are checked against the number of players when the
+	// game starts, since people can still join until then
+	for _, label := range roomsettingsdata.Cards {
+		if _, ok := cards.CardFactory[label]; !ok {
+			m := "Invalid card " + label
+			return &web.AppError{errors.New(m), m, 400}
+		}
+	}
+
+	return nil
+}
+
+// This changes the settings for the next game. Everybody has to be
+// ready again afterwards, so nobody starts a game they didn't agree to.
+func ReqRoomSettings(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	var roomsettingsdata RoomSettingsData
+	err := json.NewDecoder(r.Body).Decode(&roomsettingsdata)
+	if err != nil {
+		return web.JSONError(err)
+	}
+
+	proom, aerr := ChangeSettings(c, session, roomsettingsdata)
+	if aerr != nil {
+		return aerr
+	}
+
+	return send_room(w, r, c, *proom)
+}
+
+func ChangeSettings(c appengine.Context, session *sessions.Session, roomsettingsdata RoomSettingsData) (*data.Room, *web.AppError) {
+	if roomsettingsdata.Cards == nil {
+		roomsettingsdata.Cards = []string{}
+	}
+
+	proom, _, aerr := GetLobby(c, session)
+	if aerr != nil {
+		return nil, aerr
+	}
+
+	userID, _ := session.Values["userID"].(string)
+	return UpdateRoom(c, proom.Id, func(room *data.Room) *web.AppError {
+		aerr := ValidateRoomSettings(*room, userID, roomsettingsdata)
+		if aerr != nil {
+			return aerr
+		}
+
+		room.Cards = roomsettingsdata.Cards
+		room.AIs = roomsettingsdata.AIs
+		room.Series = roomsettingsdata.Series
+		room.BestOf = roomsettingsdata.BestOf
+		room.FixedSeating = roomsettingsdata.FixedSeating
+		room.RotateRoles = roomsettingsdata.RotateRoles
+		room.ClearReady()
+		return nil
+	})
+}
+
+func ReqRoomLeave(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	aerr := LeaveRoom(w, r, c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err := json.NewEncoder(w).Encode(&struct{}{})
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
+
+// This takes the session user out of the room's lobby. If they were
+// the host, the longest-standing player takes over.
+func LeaveRoom(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	proom, _, aerr := GetLobby(c, session)
+	if aerr != nil {
+		return aerr
+	}
+
+	userID, _ := session.Values["userID"].(string)
+	_, aerr = UpdateRoom(c, proom.Id, func(room *data.Room) *web.AppError {
+		pos, ok := room.LookupUserID(userID)
+		if !ok {
+			return nil
+		}
+
+		room.Names = append(room.Names[:pos], room.Names[pos + 1:]...)
+		room.UserIDs = append(room.UserIDs[:pos], room.UserIDs[pos + 1:]...)
+		room.Ready = append(room.Ready[:pos], room.Ready[pos + 1:]...)
+		if room.Owner == userID {
+			// An empty room goes to whoever joins it next
+			room.Owner = ""
+			if len(room.UserIDs) > 0 {
+				room.Owner = room.UserIDs[0]
+			}
+		}
+		return nil
+	})
+	if aerr != nil {
+		return aerr
+	}
+
+	delete(session.Values, "roomID")
+	delete(session.Values, "hangoutID")
+	err := session.Save(r, w)
+	if err != nil {
+		log.Println("error saving session:", err)
+	}
+
+	return nil
+}
+
+// Invite links lead here. This is public, and says what a client needs
+// to know to join the room with /room/join. It only answers with JSON:
+// the web client is still the Hangouts app, which has no lobby, so
+// rooms are for clients built on the API until it has one.
+func ReqRoomInvite(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	code := strings.TrimPrefix(r.URL.Path, "/room/")
+	proom, aerr := find_room(c, code)
+	if aerr != nil {
+		return aerr
+	}
+
+	response := struct {
+		Code string `json:"code"`
+		Players int `json:"players"`
+	}{proom.Code, len(proom.Names)}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-type", "application/json")
+	err := json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
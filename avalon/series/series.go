@@ -0,0 +1,127 @@
+package series
+
+import (
+	"appengine"
+	"avalon/data"
+	"avalon/data/cards"
+	"avalon/db"
+	"avalon/stats"
+	"errors"
+	mathrand "math/rand"
+	"time"
+)
+
+func NewSeries(room string, names []string, userids []string, labels []string, bestOf int, fixedSeating bool, rotateRoles bool) data.Series {
+	return data.Series{
+		Id: data.RandomString(64),
+		Room: room,
+		Created: time.Now(),
+		BestOf: bestOf,
+		FixedSeating: fixedSeating,
+		RotateRoles: rotateRoles,
+		Names: names,
+		UserIDs: userids,
+		Cards: labels,
+		Seating: mathrand.Perm(len(names)),
+		Scores: make([]int, len(names)),
+		Played: make([]int, len(names)),
+		EvilCounts: make([]int, len(names)),
+		Results: []data.SeriesResult{},
+	}
+}
+
+// This picks the seating and roles for the next game of a series. It
+// returns which participant sits in each seat, and which card each
+// seat holds.
+func PlanGame(series data.Series) ([]int, []int) {
+	seats := series.Seating
+	if !series.FixedSeating {
+		seats = mathrand.Perm(len(series.Names))
+	}
+
+	if !series.RotateRoles {
+		return seats, mathrand.Perm(len(series.Cards))
+	}
+
+	good := []int{}
+	evil := []int{}
+	for i, label := range series.Cards {
+		if cards.CardFactory[label]().AllocatedAsSpy() {
+			evil = append(evil, i)
+		} else {
+			good = append(good, i)
+		}
+	}
+
+	// Evil goes to the seats whose participants have been evil least
+	// often, taking the seats in a random order so that ties are
+	// broken at random
+	order := mathrand.Perm(len(seats))
+	isEvil := map[int]bool{}
+	for n := 0; n < len(evil); n++ {
+		best := -1
+		for _, seat := range order {
+			if isEvil[seat] {
+				continue
+			}
+			if best == -1 || series.EvilCounts[seats[seat]] < series.EvilCounts[seats[best]] {
+				best = seat
+			}
+		}
+		isEvil[best] = true
+	}
+
+	roles := make([]int, len(seats))
+	evilOrder := mathrand.Perm(len(evil))
+	goodOrder := mathrand.Perm(len(good))
+	for seat := range seats {
+		if isEvil[seat] {
+			roles[seat] = evil[evilOrder[0]]
+			evilOrder = evilOrder[1:]
+		} else {
+			roles[seat] = good[goodOrder[0]]
+			goodOrder = goodOrder[1:]
+		}
+	}
+	return seats, roles
+}
+
+// This adds a finished game to its series. It must be called exactly
+// once per game, in the transaction that ends it.
+func RecordGame(c appengine.Context, game data.Game) error {
+	if game.Series == "" {
+		return nil
+	}
+
+	pseries, err := db.GetSeries(c, game.Room, game.Series)
+	if err != nil {
+		return err
+	}
+	if pseries == nil {
+		return errors.New("Game is in a series which does not exist")
+	}
+	series := *pseries
+
+	winner := "evil"
+	if cards.GoodHasWon(game) {
+		winner = "good"
+	}
+	series.Results = append(series.Results, data.SeriesResult{
+		Game: game.Id,
+		Winner: winner,
+		Ending: stats.GameEnding(game),
+	})
+
+	for seat, participant := range game.SeriesSeats {
+		card := game.Cards[game.Roles[seat]]
+		series.Played[participant]++
+		if card.AllocatedAsSpy() {
+			series.EvilCounts[participant]++
+		}
+		if card.HasWon(game) {
+			series.Scores[participant]++
+		}
+	}
+
+	return db.StoreSeries(c, series)
+}
@@ -0,0 +1,218 @@
+package stats
+
+import (
+	"appengine"
+	"appengine/datastore"
+	"appengine/delay"
+	"appengine/taskqueue"
+	"avalon/data"
+	"avalon/data/cards"
+	"avalon/db"
+	"avalon/web"
+	"encoding/json"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	http.Handle("/stats/cards", web.AppHandler(ReqCardStats))
+}
+
+// How a game ended
+const (
+	EndGoodMissions = "good_missions"
+	EndEvilMissions = "evil_missions"
+	EndAssassinated = "assassinated"
+)
+
+func GameEnding(game data.Game) string {
+	if game.State.EvilScore >= 3 {
+		return EndEvilMissions
+	}
+	if !cards.GoodHasWon(game) {
+		return EndAssassinated
+	}
+	return EndGoodMissions
+}
+
+// The card set key is the sorted labels, so the same mix of cards
+// counts together however it was chosen
+func CardSetKey(labels []string) string {
+	sorted := append([]string{}, labels...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func addGame(c appengine.Context, table string, key string, ending string, games int, wins int) error {
+	stat, err := db.GetCardStat(c, table, key)
+	if err != nil {
+		return err
+	}
+
+	stat.Games += games
+	stat.Wins += wins
+	switch ending {
+	case EndGoodMissions:
+		stat.GoodMissions += games
+	case EndEvilMissions:
+		stat.EvilMissions += games
+	case EndAssassinated:
+		stat.Assassinated += games
+	}
+
+	return db.StoreCardStat(c, stat)
+}
+
+func add_game_stats(c appengine.Context, game data.Game) error {
+	ending := GameEnding(game)
+	goodWins := 0
+	if ending == EndGoodMissions {
+		goodWins = 1
+	}
+
+	err := addGame(c, "players", strconv.Itoa(len(game.Roles)), ending, 1, goodWins)
+	if err != nil {
+		return err
+	}
+
+	err = addGame(c, "cardset", CardSetKey(game.Setup.Cards), ending, 1, goodWins)
+	if err != nil {
+		return err
+	}
+
+	// Roles are counted once per seat, but each label is only read
+	// and written once
+	games := map[string]int{}
+	wins := map[string]int{}
+	labels := []string{}
+	for _, role := range game.Roles {
+		card := game.Cards[role]
+		if games[card.Label()] == 0 {
+			labels = append(labels, card.Label())
+		}
+		games[card.Label()]++
+		if card.HasWon(game) {
+			wins[card.Label()]++
+		}
+	}
+	for _, label := range labels {
+		err = addGame(c, "role", label, ending, games[label], wins[label])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type CardStatEntry struct {
+	Key string `json:"key"`
+	Games int `json:"games"`
+	// For player counts and card sets this is good's wins
+	Wins int `json:"wins"`
+	WinRate float64 `json:"win_rate"`
+	GoodMissions int `json:"good_missions"`
+	EvilMissions int `json:"evil_missions"`
+	Assassinated int `json:"assassinated"`
+}
+
+type CardStatsResponse struct {
+	Roles []CardStatEntry `json:"roles"`
+	Players []CardStatEntry `json:"players"`
+	CardSets []CardStatEntry `json:"card_sets"`
+}
+
+var recordGameLater = delay.Func("stats.RecordGame", record_game)
+
+// This adds a finished game to the card stats, unless it has been
+// added already
+func record_game(c appengine.Context, roomid string, gameid string) error {
+	game, err := db.RetrieveGame(c, roomid, gameid)
+	if err != nil {
+		return err
+	}
+	if game == nil {
+		c.Errorf("No game %s in %s to add to the card stats", gameid, roomid)
+		return nil
+	}
+	err = db.EnsureGameState(c, game, true)
+	if err != nil {
+		return err
+	}
+	if !game.State.GameOver {
+		c.Errorf("Game %s in %s isn't over, so not adding it to the card stats", gameid, roomid)
+		return nil
+	}
+
+	return datastore.RunInTransaction(c, func(tc appengine.Context) error {
+		recorded, err := db.CardStatsHaveGame(tc, roomid, gameid)
+		if err != nil || recorded {
+			return err
+		}
+
+		err = add_game_stats(tc, *game)
+		if err != nil {
+			return err
+		}
+		return db.StoreCardStatGame(tc, roomid, gameid, data.CardStatGame{time.Now()})
+	}, nil)
+}
+
+// This is called in the transaction that ends a game. It adds a task
+// to put the game in the card stats, which only runs if the
+// transaction commits; the task retries until it succeeds.
+func RecordGame(c appengine.Context, game data.Game) error {
+	task, err := recordGameLater.Task(game.Room, game.Id)
+	if err != nil {
+		return err
+	}
+	_, err = taskqueue.Add(c, task, "")
+	return err
+}
+
+func ReqCardStats(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session) *web.AppError {
+	stats, err := db.GetCardStats(c)
+	if err != nil {
+		return &web.AppError{err, "Error retrieving card stats", 500}
+	}
+
+	response := CardStatsResponse{
+		Roles: []CardStatEntry{},
+		Players: []CardStatEntry{},
+		CardSets: []CardStatEntry{},
+	}
+	for _, stat := range stats {
+		entry := CardStatEntry{
+			Key: stat.Key,
+			Games: stat.Games,
+			Wins: stat.Wins,
+			GoodMissions: stat.GoodMissions,
+			EvilMissions: stat.EvilMissions,
+			Assassinated: stat.Assassinated,
+		}
+		if stat.Games > 0 {
+			entry.WinRate = float64(stat.Wins) / float64(stat.Games)
+		}
+
+		switch stat.Table {
+		case "role":
+			response.Roles = append(response.Roles, entry)
+		case "players":
+			response.Players = append(response.Players, entry)
+		case "cardset":
+			response.CardSets = append(response.CardSets, entry)
+		}
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	err = json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		return &web.AppError{err, "Error encoding json", 500}
+	}
+
+	return nil
+}
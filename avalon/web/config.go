@@ -0,0 +1,95 @@
+package web
+
+import (
+	"appengine"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+)
+
+type WebConfig struct {
+	// Where the client talks to the server, in production and when
+	// testing against a dev server
+	ServerPath string `json:"server_path"`
+	DevServerPath string `json:"dev_server_path"`
+
+	// The origins which may make ajax calls. These are patterns as in
+	// path.Match, so "https://*.example.com" matches any subdomain.
+	// The origins of the server paths are always allowed. Allowed
+	// origins can read app.js's CSRF token, so never allow a host which
+	// serves other people's pages, such as all of googleusercontent.com.
+	AllowedOrigins []string `json:"allowed_origins"`
+
+	Sessions SessionConfig `json:"sessions"`
+}
+
+var Config WebConfig
+
+func origin_of(serverPath string) string {
+	u, err := url.Parse(serverPath)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// This reads the web config, and sets up the session store from it
+func LoadWebConfig(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&Config)
+	if err != nil {
+		return err
+	}
+
+	for _, serverPath := range []string{Config.ServerPath, Config.DevServerPath} {
+		origin := origin_of(serverPath)
+		if origin != "" {
+			Config.AllowedOrigins = append(Config.AllowedOrigins, origin)
+		}
+	}
+	for _, pattern := range Config.AllowedOrigins {
+		_, err = path.Match(pattern, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return setSessionStore(Config.Sessions)
+}
+
+func OriginAllowed(origin string) bool {
+	for _, pattern := range Config.AllowedOrigins {
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// This allows the request's origin to read the response, if it is in
+// the allowlist. Requests with no origin are same-origin (or not from
+// a browser), and are let through without CORS headers. It returns
+// false if the request should be rejected.
+func CheckOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if !OriginAllowed(origin) {
+		c := appengine.NewContext(r)
+		c.Warningf("Rejected %s %s from origin %s, which is not in allowed_origins", r.Method, r.URL.Path, origin)
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+	return true
+}
@@ -0,0 +1,56 @@
+package web
+
+import (
+	"appengine"
+	"avalon/api"
+	"encoding/json"
+	"net/http"
+)
+
+// A ClientError is the Err of an AppError with its own error code, and
+// optionally details for the client
+type ClientError struct {
+	Code string
+	Details interface{}
+}
+
+func (e ClientError) Error() string {
+	return e.Code
+}
+
+func Coded(code string) error {
+	return ClientError{Code: code}
+}
+
+// This is the AppError for a request body which isn't valid JSON, with
+// the parser's complaint as the details
+func JSONError(err error) *AppError {
+	return &AppError{ClientError{api.ErrInvalidJSON, err.Error()}, "Error parsing json body", 400}
+}
+
+// This is the error as the client sees it
+func (e *AppError) Response() api.Error {
+	response := api.Error{Message: e.Message, Status: e.Code}
+	if coded, ok := e.Err.(ClientError); ok {
+		response.Code = coded.Code
+		response.Details = coded.Details
+	} else if code, ok := api.StatusCodes[e.Code]; ok {
+		response.Code = code
+	} else {
+		response.Code = api.ErrInternal
+	}
+	return response
+}
+
+// This logs an error and sends it to the client as JSON
+func writeError(w http.ResponseWriter, c appengine.Context, e *AppError) {
+	c.Errorf("%s: %s", e.Message, e.Err)
+
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(e.Code)
+	response := e.Response()
+	err := json.NewEncoder(w).Encode(&response)
+	if err != nil {
+		c.Errorf("Error encoding error: %s", err)
+	}
+}
@@ -0,0 +1,168 @@
+package web
+
+import (
+	"appengine"
+	"avalon/data"
+	"avalon/db"
+	"avalon/web/keys"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"net/http"
+	"time"
+)
+
+// These are the cookie key pairs (authentication, encryption), the
+// current pair first. Cookies are written with the current pair and
+// read with any of them. To rotate, add a new pair to web/keys and put
+// it first here, then drop the old pair once its cookies have expired.
+var cookieKeyPairs = [][2]string{
+	{keys.CookieKey1Auth, keys.CookieKey1Encr},
+}
+
+func cookieKeys() [][]byte {
+	pairs := [][]byte{}
+	for _, pair := range cookieKeyPairs {
+		pairs = append(pairs, []byte(pair[0]), []byte(pair[1]))
+	}
+	return pairs
+}
+
+// A DatastoreStore keeps session values on the server, and only the
+// session's ID in the cookie, so sessions can hold more than fits in
+// a cookie
+type DatastoreStore struct {
+	Codecs []securecookie.Codec
+	Options *sessions.Options
+}
+
+func NewDatastoreStore(keyPairs ...[]byte) *DatastoreStore {
+	return &DatastoreStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path: "/",
+			MaxAge: 86400 * 30,
+		},
+	}
+}
+
+// This sets how long sessions last, in the cookie and for the codecs,
+// which check it when reading the cookie
+func (s *DatastoreStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+func (s *DatastoreStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// This returns the session in the request's cookie, or a new one if
+// there is no cookie or its session has gone
+func (s *DatastoreStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	err = securecookie.DecodeMulti(name, cookie.Value, &session.ID, s.Codecs...)
+	if err != nil {
+		return session, err
+	}
+
+	c := appengine.NewContext(r)
+	stored, err := db.GetSession(c, session.ID)
+	if err != nil {
+		return session, err
+	}
+	if stored == nil {
+		session.ID = ""
+		return session, nil
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(stored.Values)).Decode(&session.Values)
+	if err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+func (s *DatastoreStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	c := appengine.NewContext(r)
+
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			err := db.DeleteSession(c, session.ID)
+			if err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = data.RandomString(32)
+	}
+
+	var values bytes.Buffer
+	err := gob.NewEncoder(&values).Encode(session.Values)
+	if err != nil {
+		return err
+	}
+	stored := db.StoredSession{
+		Values: values.Bytes(),
+		Expires: time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+	err = db.StoreSession(c, session.ID, stored)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+type SessionConfig struct {
+	// "cookie" keeps the session values in the cookie, and "datastore"
+	// keeps them on the server
+	Store string `json:"store"`
+	// How long sessions last, in seconds, if not the default
+	MaxAge int `json:"max_age"`
+}
+
+// This replaces Store to match the config
+func setSessionStore(config SessionConfig) error {
+	switch config.Store {
+	case "", "cookie":
+		store := sessions.NewCookieStore(cookieKeys()...)
+		if config.MaxAge > 0 {
+			store.MaxAge(config.MaxAge)
+		}
+		Store = store
+	case "datastore":
+		store := NewDatastoreStore(cookieKeys()...)
+		if config.MaxAge > 0 {
+			store.MaxAge(config.MaxAge)
+		}
+		Store = store
+	default:
+		return errors.New("Invalid session store " + config.Store)
+	}
+	return nil
+}
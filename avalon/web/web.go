@@ -2,21 +2,35 @@ package web
 
 import (
 	"appengine"
+	"avalon/api"
 	"avalon/data"
 	"avalon/db"
-	"avalon/web/keys"
 	"errors"
 	"github.com/gorilla/sessions"
 	"net/http"
 )
 
-// Store initializes the Gorilla session store.
-var Store = sessions.NewCookieStore([]byte(keys.CookieKey1Auth), []byte(keys.CookieKey1Encr))
+// Store initializes the Gorilla session store. LoadSessionConfig may
+// replace it with a server-side store.
+var Store sessions.Store = sessions.NewCookieStore(cookieKeys()...)
+
+// GuestStore holds the cookie which says who a guest is. It lasts much
+// longer than a session, so that guests keep their history.
+var GuestStore = sessions.NewCookieStore(cookieKeys()...)
+
+func init() {
+	// This sets the codecs' limit too, which they check when reading
+	GuestStore.MaxAge(365 * 24 * 60 * 60)
+	GuestStore.Options.HttpOnly = true
+}
 
 type AppHandler func(http.ResponseWriter, *http.Request, appengine.Context, *sessions.Session) *AppError
 type AjaxHandler func(http.ResponseWriter, *http.Request, appengine.Context, *sessions.Session) *AppError
 type GameHandler func(http.ResponseWriter, *http.Request, appengine.Context, *sessions.Session, data.Game, int) *AppError
 
+// An AppError is sent to the client as an api.Error. Code is the
+// HTTP status; Err may be a ClientError to give a more specific error
+// code than the status does.
 type AppError struct {
 	Err     error
 	Message string
@@ -29,13 +43,18 @@ func (fn AppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 
 	if e := fn(w, r, c, session); e != nil {
-		c.Errorf("%s: %s", e.Message, e.Err)
-		http.Error(w, e.Message, e.Code)
+		writeError(w, c, e)
 	}
 }
 
+// This returns true if the request has been dealt with: either it was
+// a preflight, or it came from an origin which isn't allowed
 func ajax_cors(w http.ResponseWriter, r *http.Request) bool {
-	w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("origin"))
+	if !CheckOrigin(w, r) {
+		m := "Origin not allowed"
+		writeError(w, appengine.NewContext(r), &AppError{Coded(api.ErrOriginNotAllowed), m, 403})
+		return true
+	}
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "accept, content-type, cookie, x-csrf-token")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
@@ -55,30 +74,39 @@ func (fn AjaxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	state := session.Values["state"].(string)
 	csrfToken  := r.Header.Get("x-csrf-token")
+	c := appengine.NewContext(r)
 	if csrfToken != state {
-		http.Error(w, "Invalid CSRF token", 403)
+		m := "Invalid CSRF token"
+		writeError(w, c, &AppError{Coded(api.ErrInvalidCSRFToken), m, 403})
 		return
 	}
 
-	c := appengine.NewContext(r)
-
 	if e := fn(w, r, c, session); e != nil { // e is *AppError, not os.Error.
-		c.Errorf("%s: %s", e.Message, e.Err)
-		http.Error(w, e.Message, e.Code)
+		writeError(w, c, e)
+	}
+}
+
+// This returns the session's room. Sessions from before there were
+// rooms have it as hangoutID.
+func SessionRoomID(session *sessions.Session) string {
+	if roomID, ok := session.Values["roomID"].(string); ok {
+		return roomID
 	}
+	roomID, _ := session.Values["hangoutID"].(string)
+	return roomID
 }
 
 func gameSetup(w http.ResponseWriter, r *http.Request, c appengine.Context, session *sessions.Session, mygame *data.Game, mypos *int) *AppError {
 	gameID, ok := session.Values["gameID"].(string)
 	if !ok || 0 == len(gameID) {
 		m := "Not in a game"
-		return &AppError{errors.New(m), m, 403}
+		return &AppError{Coded(api.ErrNotInGame), m, 403}
 	}
 
 	userID, _ := session.Values["userID"].(string)
-	hangoutID, _ := session.Values["hangoutID"].(string)
+	roomID := SessionRoomID(session)
 
-	game, err := db.RetrieveGame(c, hangoutID, gameID)
+	game, err := db.RetrieveGame(c, roomID, gameID)
 	if err != nil {
 		return &AppError{err, "Error fetching game from datastore", 500}
 	}
@@ -87,15 +115,15 @@ func gameSetup(w http.ResponseWriter, r *http.Request, c appengine.Context, sess
 		return &AppError{errors.New(m), m, 404}
 	}
 
-	if game.Hangout != hangoutID {
-		m := "Incorrect hangout for gameid"
-		return &AppError{errors.New(m), m, 403}
+	if game.Room != roomID {
+		m := "Incorrect room for gameid"
+		return &AppError{Coded(api.ErrNotInGame), m, 403}
 	}
 
 	pos, ok := game.LookupUserID(userID)
 	if !ok {
 		m := "Not a user in that game"
-		return &AppError{errors.New(m), m, 500}
+		return &AppError{Coded(api.ErrNotInGame), m, 403}
 	}
 
 	*mygame = *game
@@ -113,24 +141,23 @@ func (fn GameHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	state := session.Values["state"].(string)
 	csrfToken  := r.Header.Get("x-csrf-token")
+	c := appengine.NewContext(r)
 	if csrfToken != state {
-		http.Error(w, "Invalid CSRF token", 403)
+		m := "Invalid CSRF token"
+		writeError(w, c, &AppError{Coded(api.ErrInvalidCSRFToken), m, 403})
 		return
 	}
 
-	c := appengine.NewContext(r)
 	var game data.Game
 	var mypos int
 	e := gameSetup(w, r, c, session, &game, &mypos)
 	if e != nil {
-		c.Errorf("%s: %s", e.Message, e.Err)
-		http.Error(w, e.Message, e.Code)
+		writeError(w, c, e)
 		return
 	}
 
 	if e = fn(w, r, c, session, game, mypos); e != nil { // e is *AppError, not os.Error.
-		c.Errorf("%s: %s", e.Message, e.Err)
-		http.Error(w, e.Message, e.Code)
+		writeError(w, c, e)
 	}
 }
 
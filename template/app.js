@@ -60,7 +60,7 @@
                 'cookiepolicy': 'single_host_origin',
                 'callback': 'auth_callback_gapi',
                 'redirecturi': 'postmessage',
-                'scope': 'https://www.googleapis.com/auth/plus.me',
+                'scope': 'openid https://www.googleapis.com/auth/plus.me',
             });
 
             this.interval = null;
@@ -101,7 +101,8 @@
         this.auth_got = true;
 
         this.api('auth/token',
-                 {token: gapi.auth.getToken().access_token,
+                 {provider: 'google',
+                  token: gapi.auth.getToken().id_token,
                   myid: gapi.hangout.getLocalParticipantId(),
                   hangout: gapi.hangout.getHangoutId(),
                  })